@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/gc"
+	"github.com/joshtenorio/glassypdm-server/internal/locks"
+)
+
+// admin commands are run as `glassypdm-server <command> [flags]`
+// and exit once they are done instead of starting the server
+func runAdminCommand(ctx context.Context, command string, args []string) {
+	switch command {
+	case "gc":
+		flags := flag.NewFlagSet("gc", flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "report what would be removed without removing it")
+		grace := flags.Duration("grace", gcGracePeriod(), "skip anything newer than this")
+		sweepObjects := flags.Bool("objects", gcSweepObjects(), "also remove stored blocks that have no database row")
+		flags.Parse(args)
+
+		report, err := gc.Run(ctx, *grace, *dryRun, *sweepObjects)
+		if err != nil {
+			log.Fatal("garbage collection failed", "err", err)
+		}
+		output, _ := json.MarshalIndent(report, "", "  ")
+		os.Stdout.Write(append(output, '\n'))
+	case "repair-numbering":
+		renumbered, err := dal.Queries.RepairNumbering(ctx)
+		if err != nil {
+			log.Fatal("couldn't repair numbering", "err", err)
+		}
+		log.Info("repaired commit and file revision numbering", "renumbered", renumbered)
+	case "expire-locks":
+		released, err := locks.Sweep(ctx)
+		if err != nil {
+			log.Fatal("couldn't release expired locks", "err", err)
+		}
+		log.Info("released expired locks", "locks", released)
+	case "user-add":
+		// the password is read from stdin so it doesn't end up in the shell history
+		flags := flag.NewFlagSet("user-add", flag.ExitOnError)
+		email := flags.String("email", "", "email to log in with")
+		name := flags.String("name", "", "display name")
+		flags.Parse(args)
+		if *email == "" || *name == "" {
+			log.Fatal("user-add needs -email and -name")
+		}
+		userId, err := auth.CreateLocalUser(ctx, *email, *name, readPassword())
+		if err != nil {
+			log.Fatal("couldn't add user", "err", err)
+		}
+		log.Info("added local user", "user", userId, "email", *email)
+	case "user-password":
+		flags := flag.NewFlagSet("user-password", flag.ExitOnError)
+		email := flags.String("email", "", "email of the user")
+		flags.Parse(args)
+		if *email == "" {
+			log.Fatal("user-password needs -email")
+		}
+		err := auth.SetLocalUserPassword(ctx, *email, readPassword())
+		if err != nil {
+			log.Fatal("couldn't set password", "err", err)
+		}
+		log.Info("changed password", "email", *email)
+	default:
+		log.Fatal("unknown command", "command", command)
+	}
+}
+
+// reads a password from the first line of stdin
+func readPassword() string {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		log.Fatal("couldn't read password", "err", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// background jobs are configured by their interval, e.g. GC_INTERVAL=24h
+func startBackgroundJobs(ctx context.Context) {
+	if interval := os.Getenv("GC_INTERVAL"); interval != "" {
+		duration, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatal("GC_INTERVAL is not a valid duration", "value", interval)
+		}
+		log.Info("starting garbage collection job", "interval", duration)
+		gc.StartBackground(ctx, duration, gcGracePeriod(), gcSweepObjects())
+	}
+
+	// lock expiry is on by default since teams opt in with their lock timeout,
+	// LOCK_SWEEP_INTERVAL=0 turns it off
+	sweepInterval := locks.DefaultSweepInterval
+	if interval := os.Getenv("LOCK_SWEEP_INTERVAL"); interval != "" {
+		duration, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatal("LOCK_SWEEP_INTERVAL is not a valid duration", "value", interval)
+		}
+		sweepInterval = duration
+	}
+	if sweepInterval > 0 {
+		log.Info("starting lock sweeper", "interval", sweepInterval)
+		locks.StartBackground(ctx, sweepInterval)
+	}
+}
+
+func gcGracePeriod() time.Duration {
+	grace := os.Getenv("GC_GRACE_PERIOD")
+	if grace == "" {
+		return gc.DefaultGracePeriod
+	}
+	duration, err := time.ParseDuration(grace)
+	if err != nil {
+		log.Warn("GC_GRACE_PERIOD is not a valid duration, using default", "value", grace)
+		return gc.DefaultGracePeriod
+	}
+	return duration
+}
+
+// removing objects without a block row is off unless GC_SWEEP_OBJECTS is set,
+// since the bucket might be shared with something else
+func gcSweepObjects() bool {
+	sweep := os.Getenv("GC_SWEEP_OBJECTS")
+	if sweep == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(sweep)
+	if err != nil {
+		log.Warn("GC_SWEEP_OBJECTS is not a valid bool, leaving it off", "value", sweep)
+		return false
+	}
+	return enabled
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-chi/chi/v5"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/observer"
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+	"github.com/joshtenorio/glassypdm-server/internal/store"
+	"github.com/posthog/posthog-go"
+)
+
+var archiveFilenamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// a file to put in an archive, with its chunks in order
+type archiveFile struct {
+	Name   string // path inside the archive
+	Size   int64
+	Chunks []sqlcgen.GetFileChunksRow
+}
+
+/*
+input: url param project-id, query:
+- ref=<cno or tag>, or branch=<name> for the head of a branch, main's head if neither is set
+- prefix=<folder or file> to only include some of the project
+- format=zip|tar, zip by default
+streams the project as it was at the commit. takes a download store token,
+which can be passed as ?jwt= so the archive can be downloaded with just a link
+*/
+func GetProjectArchive(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	userId, scope, ok := getStoreCaller(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "tar" {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+
+	if !canUseStore(userId, scope, projectId, true) {
+		WriteCustomError(w, "no permission")
+		return
+	}
+
+	var commitId int32
+	if ref := r.URL.Query().Get("ref"); ref != "" {
+		commitId, _, err = resolveCommitRef(ctx, projectId, ref)
+		if err != nil {
+			log.Warn("couldn't find commit", "ref", ref, "project", projectId)
+			WriteCustomError(w, "invalid commit")
+			return
+		}
+	} else {
+		branch, err := resolveBranch(ctx, projectId, r.URL.Query().Get("branch"))
+		if err != nil {
+			WriteCustomError(w, "invalid branch")
+			return
+		}
+		commitId, err = getBranchHead(ctx, &dal.Queries, projectId, branch.Branchid)
+		if err != nil {
+			log.Error("couldn't get latest commit", "project", projectId, "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+	}
+	info, err := dal.Queries.GetCommitInfo(ctx, commitId)
+	if err != nil {
+		log.Error("couldn't get commit info", "commit", commitId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	title, err := dal.Queries.GetProjectInfo(ctx, int32(projectId))
+	if err != nil {
+		log.Error("couldn't get project info", "project", projectId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	// look everything up before we start streaming so we can still send an error
+	files, err := findArchiveFiles(ctx, projectId, commitId, r.URL.Query().Get("prefix"))
+	if err != nil {
+		log.Error("couldn't collect archive files", "project", projectId, "commit", commitId, "err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	if len(files) == 0 {
+		WriteCustomError(w, "no files")
+		return
+	}
+
+	filename := archiveFilenamePattern.ReplaceAllString(title, "_") + "-" + strconv.Itoa(int(info.Cno.Int32)) + "." + format
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		err = writeZipArchive(ctx, w, files, info.Timestamp.Time)
+	} else {
+		w.Header().Set("Content-Type", "application/x-tar")
+		err = writeTarArchive(ctx, w, files, info.Timestamp.Time)
+	}
+	if err != nil {
+		// the response is already partly written, all we can do is cut it off
+		log.Error("couldn't write archive", "project", projectId, "commit", commitId, "err", err)
+		return
+	}
+	observer.PostHogClient.Enqueue(posthog.Capture{
+		DistinctId: userId,
+		Event:      "archive-download",
+		Properties: posthog.NewProperties().
+			Set("project-id", projectId).
+			Set("format", format).
+			Set("numberFiles", len(files)),
+	})
+}
+
+// returns the files that exist at commitId under prefix, sorted by path.
+// errors if a file is missing any of its chunks
+func findArchiveFiles(ctx context.Context, projectId int, commitId int32, prefix string) ([]archiveFile, error) {
+	revisions, err := getRevisionsAtCommit(ctx, &dal.Queries, projectId, commitId)
+	if err != nil {
+		return nil, err
+	}
+	prefix = archiveName(prefix)
+	paths := make([]string, 0, len(revisions))
+	for p, revision := range revisions {
+		if revision.Changetype != ChangeTypeDelete && underPrefix(archiveName(p), prefix) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	files := make([]archiveFile, 0, len(paths))
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		name := archiveName(p)
+		if name == "" || seen[name] {
+			log.Warn("skipping path in archive", "project", projectId, "path", p)
+			continue
+		}
+		seen[name] = true
+
+		hash := revisions[p].Filehash
+		chunks, err := dal.Queries.GetFileChunks(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		file := archiveFile{Name: name, Chunks: chunks}
+		for i, chunk := range chunks {
+			if int(chunk.Chunkindex) != i {
+				return nil, fmt.Errorf("file %s is missing chunk %d", hash, i)
+			}
+			file.Size += int64(chunk.Blocksize)
+		}
+		if revisions[p].Numchunks > 0 && len(chunks) != int(revisions[p].Numchunks) {
+			return nil, fmt.Errorf("file %s has %d of %d chunks", hash, len(chunks), revisions[p].Numchunks)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// turns a project path into a relative path with forward slashes that can't climb out of the archive,
+// "" if nothing is left
+func archiveName(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(p, "\\", "/")), "/")
+}
+
+// whether name is prefix or inside it. both are archive names, and only whole
+// segments match so "part" doesn't pick up "parts/". an empty prefix matches everything
+func underPrefix(name string, prefix string) bool {
+	return prefix == "" || name == prefix || strings.HasPrefix(name, prefix+"/")
+}
+
+func writeZipArchive(ctx context.Context, w io.Writer, files []archiveFile, modified time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.Name,
+			Method:   zip.Deflate,
+			Modified: modified,
+		})
+		if err != nil {
+			return err
+		}
+		if err := copyFileChunks(ctx, fw, file); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarArchive(ctx context.Context, w io.Writer, files []archiveFile, modified time.Time) error {
+	tw := tar.NewWriter(w)
+	for _, file := range files {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     file.Name,
+			Size:     file.Size,
+			Mode:     0644,
+			ModTime:  modified,
+		})
+		if err != nil {
+			return err
+		}
+		if err := copyFileChunks(ctx, tw, file); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// writes the file's blocks to w in chunk order
+func copyFileChunks(ctx context.Context, w io.Writer, file archiveFile) error {
+	for _, chunk := range file.Chunks {
+		blob, err := store.Blobs.Get(ctx, chunk.Blockhash)
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("block %s is missing from the store", chunk.Blockhash)
+		} else if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, blob)
+		blob.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
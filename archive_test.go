@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestArchiveName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"part.sldprt", "part.sldprt"},
+		{"assembly/part.sldprt", "assembly/part.sldprt"},
+		{"assembly\\sub\\part.sldprt", "assembly/sub/part.sldprt"},
+		{"/absolute/part.sldprt", "absolute/part.sldprt"},
+		{"../../etc/passwd", "etc/passwd"},
+		{"a/../../b", "b"},
+		{"..\\..\\b", "b"},
+		{"a//b/./c", "a/b/c"},
+		{"", ""},
+		{"..", ""},
+		{"/", ""},
+	}
+	for _, test := range tests {
+		if got := archiveName(test.path); got != test.want {
+			t.Errorf("archiveName(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestUnderPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   bool
+	}{
+		{"assembly/part.sldprt", "", true},
+		{"assembly/part.sldprt", "assembly", true},
+		{"assembly/part.sldprt", "assembly/part.sldprt", true},
+		{"assembly/sub/part.sldprt", "assembly/sub", true},
+		{"assembly2/part.sldprt", "assembly", false},
+		{"parts/a.sldprt", "part", false},
+		{"assembly/part.sldprt", "assembly/part", false},
+		{"assembly", "assembly/part.sldprt", false},
+	}
+	for _, test := range tests {
+		if got := underPrefix(test.name, test.prefix); got != test.want {
+			t.Errorf("underPrefix(%q, %q) = %v, want %v", test.name, test.prefix, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+)
+
+// branch 0 is main, which isn't stored in the branch table
+const mainBranchName = "main"
+
+var errBranchNotFound = errors.New("branch not found")
+
+// looks up a branch by name, "" and "main" are main
+func resolveBranch(ctx context.Context, projectId int, name string) (sqlcgen.GetBranchByNameRow, error) {
+	if name == "" || name == mainBranchName {
+		return sqlcgen.GetBranchByNameRow{}, nil
+	}
+	branch, err := dal.Queries.GetBranchByName(ctx, sqlcgen.GetBranchByNameParams{Projectid: int32(projectId), Name: name})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return branch, errBranchNotFound
+	}
+	return branch, err
+}
+
+// returns the commit id new commits on the branch build on
+func getBranchHead(ctx context.Context, q *sqlcgen.Queries, projectId int, branchId int32) (int32, error) {
+	if branchId == 0 {
+		return q.GetLatestCommit(ctx, int32(projectId))
+	}
+	return q.GetBranchHead(ctx, branchId)
+}
+
+// whether commitId is from the branch's lineage up to its last promotion,
+// which stops being the branch's ancestry once a replay promote moves it onto main's new commit
+func isPromotedBefore(ctx context.Context, q *sqlcgen.Queries, projectId int, branchId int32, commitId int32) (bool, error) {
+	if branchId == 0 {
+		return false, nil
+	}
+	promoted, err := q.GetBranchPromoted(ctx, branchId)
+	if err != nil || promoted == 0 {
+		return false, err
+	}
+	return q.IsAncestorCommit(ctx, sqlcgen.IsAncestorCommitParams{
+		Projectid:  int32(projectId),
+		HeadCommit: promoted,
+		Commitid:   commitId,
+	})
+}
+
+type Branch struct {
+	Name           string `json:"name"`
+	CreatorId      string `json:"creator_id"`
+	Timestamp      int64  `json:"timestamp"`
+	BaseCommit     int    `json:"base_commit"`     // commit id on main
+	HeadCommit     int    `json:"head_commit"`     // commit id
+	HeadNumber     int    `json:"head_number"`     // commit number
+	PromotedCommit int    `json:"promoted_commit"` // last commit promoted onto main, 0 if none
+}
+
+type CreateBranchRequest struct {
+	Name     string `json:"name"`
+	CommitId int    `json:"commit_id"` // commit on main to branch from, 0 for the latest
+}
+
+type PromoteBranchRequest struct {
+	Name   string `json:"name"`
+	DryRun bool   `json:"dry_run"`
+}
+
+type PromoteBranchOutput struct {
+	Mode     string          `json:"mode"`      // fast-forward or replay
+	CommitId int             `json:"commit_id"` // head of main afterwards
+	DryRun   bool            `json:"dry_run"`
+	Changes  []RestoreChange `json:"changes"` // only for replays
+}
+
+type PromoteConflictOutput struct {
+	BaseCommit int      `json:"base_commit"`
+	HeadCommit int      `json:"head_commit"`
+	Paths      []string `json:"paths"` // paths changed on both main and the branch
+}
+
+// input: url param project-id, body {name, commit_id}
+func CreateBranch(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request CreateBranchRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+	// same rules as tag names
+	if request.Name == mainBranchName || len(request.Name) > maxTagNameLength || !tagNamePattern.MatchString(request.Name) {
+		WriteCustomError(w, "invalid branch name")
+		return
+	}
+
+	if GetProjectPermissionByID(userId, projectId) < 2 {
+		log.Warn("insufficient permission", "user", userId, "projectId", projectId)
+		WriteCustomError(w, "no permission")
+		return
+	}
+
+	base := int32(request.CommitId)
+	if base == 0 {
+		base, err = dal.Queries.GetLatestCommit(ctx, int32(projectId))
+		if err != nil {
+			log.Error("couldn't get latest commit", "project", projectId, "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+	}
+	// branches only split off from main
+	info, err := dal.Queries.GetCommitInfo(ctx, base)
+	if err != nil || int(info.Projectid) != projectId || info.Branchid != 0 {
+		WriteCustomError(w, "invalid commit")
+		return
+	}
+
+	_, err = dal.Queries.InsertBranch(ctx, sqlcgen.InsertBranchParams{
+		Projectid:  int32(projectId),
+		Name:       request.Name,
+		Basecommit: base,
+		Userid:     userId,
+	})
+	if err != nil {
+		var e *pgconn.PgError
+		if errors.As(err, &e) && e.Code == pgerrcode.UniqueViolation {
+			WriteCustomError(w, "branch exists")
+			return
+		}
+		log.Error("couldn't create branch", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	WriteDefaultSuccess(w, "branch created")
+}
+
+// input: url param project-id
+// returns the project's branches, not including main
+func GetProjectBranches(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+
+	if GetProjectPermissionByID(claims.Subject, projectId) < 1 {
+		WriteCustomError(w, "no permission")
+		return
+	}
+
+	rows, err := dal.Queries.ListProjectBranches(ctx, int32(projectId))
+	if err != nil {
+		log.Error("couldn't list branches", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	branches := make([]Branch, 0, len(rows))
+	for _, row := range rows {
+		head, err := dal.Queries.GetCommitInfo(ctx, row.Headcommit)
+		if err != nil {
+			log.Error("couldn't get commit info", "commit", row.Headcommit, "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		branches = append(branches, Branch{
+			Name:           row.Name,
+			CreatorId:      row.Userid,
+			Timestamp:      row.Timestamp.Time.UnixNano() / 1000000000,
+			BaseCommit:     int(row.Basecommit),
+			HeadCommit:     int(row.Headcommit),
+			HeadNumber:     int(head.Cno.Int32),
+			PromotedCommit: int(row.Promoted),
+		})
+	}
+	output_bytes, _ := json.Marshal(branches)
+	WriteSuccess(w, string(output_bytes))
+}
+
+/*
+input: url param project-id, body {name, dry_run}
+puts the branch's commits since its last promotion onto main.
+if main hasn't moved since the branch's base commit the commits are moved over as they are,
+otherwise the branch's changes are replayed in a new commit on main,
+as long as main hasn't touched any of the same paths.
+either way the branch carries on from main's new head, so after a replay, commits based on
+the branch's old head get a "rebase" response until the client syncs to the new head
+*/
+func PromoteBranch(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request PromoteBranchRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	if GetProjectPermissionByID(userId, projectId) < 3 {
+		log.Warn("insufficient permission", "user", userId, "projectId", projectId)
+		WriteCustomError(w, "no permission")
+		return
+	}
+
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	// no other commits to main or the branch while we work out what changed
+	err = qtx.LockProjectForCommit(ctx, int32(projectId))
+	if err != nil {
+		log.Error("couldn't lock project", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	branch, err := qtx.GetBranchByName(ctx, sqlcgen.GetBranchByNameParams{Projectid: int32(projectId), Name: request.Name})
+	if errors.Is(err, pgx.ErrNoRows) {
+		WriteCustomError(w, "branch not found")
+		return
+	} else if err != nil {
+		log.Error("couldn't get branch", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	mainHead, err := qtx.GetLatestCommit(ctx, int32(projectId))
+	if err != nil {
+		log.Error("couldn't get latest commit", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	branchHead, err := qtx.GetBranchHead(ctx, branch.Branchid)
+	if err != nil {
+		log.Error("couldn't get branch head", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	paths, err := qtx.ListBranchChangedPaths(ctx, sqlcgen.ListBranchChangedPathsParams{Branchid: branch.Branchid, Commitid: branch.Promoted})
+	if err != nil {
+		log.Error("couldn't get changed paths", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	if len(paths) == 0 {
+		WriteCustomError(w, "nothing to promote")
+		return
+	}
+
+	// main moved on, make sure it left the branch's paths alone
+	if mainHead != branch.Basecommit {
+		conflicts, err := qtx.FindConflictingPaths(ctx, sqlcgen.FindConflictingPathsParams{
+			Projectid:    int32(projectId),
+			ParentCommit: branch.Basecommit,
+			Paths:        paths,
+			HeadCommit:   mainHead,
+		})
+		if err != nil {
+			log.Error("couldn't check for conflicts", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		if len(conflicts) > 0 {
+			log.Warn("branch conflicts with main", "project", projectId, "branch", request.Name, "len", len(conflicts))
+			output := PromoteConflictOutput{BaseCommit: int(branch.Basecommit), HeadCommit: int(mainHead), Paths: conflicts}
+			output_bytes, _ := json.Marshal(output)
+			PrintResponse(w, "conflict", string(output_bytes))
+			return
+		}
+	}
+
+	locks, err := findLocksHeldByOthers(ctx, qtx, projectId, userId, paths)
+	if err != nil {
+		log.Error("couldn't check file locks", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	if len(locks) > 0 {
+		output_bytes, _ := json.Marshal(LockConflictOutput{Locks: locks})
+		PrintResponse(w, "locked", string(output_bytes))
+		return
+	}
+
+	output := PromoteBranchOutput{DryRun: request.DryRun, Changes: make([]RestoreChange, 0)}
+	if mainHead == branch.Basecommit {
+		output.Mode = "fast-forward"
+		output.CommitId = int(branchHead)
+		if request.DryRun {
+			output_bytes, _ := json.Marshal(output)
+			WriteSuccess(w, string(output_bytes))
+			return
+		}
+		_, err = qtx.FastForwardBranch(ctx, sqlcgen.FastForwardBranchParams{Branchid: branch.Branchid, Commitid: branch.Promoted})
+		if err != nil {
+			log.Error("couldn't move branch commits", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+	} else {
+		output.Mode = "replay"
+		current, err := getRevisionsAtCommit(ctx, qtx, projectId, mainHead)
+		if err != nil {
+			log.Error("couldn't get main state", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		target, err := getRevisionsAtCommit(ctx, qtx, projectId, branchHead)
+		if err != nil {
+			log.Error("couldn't get branch state", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		output.Changes = replayChanges(current, target, paths)
+		if request.DryRun {
+			output.CommitId = int(mainHead)
+			output_bytes, _ := json.Marshal(output)
+			WriteSuccess(w, string(output_bytes))
+			return
+		}
+		if len(output.Changes) == 0 {
+			WriteCustomError(w, "nothing to promote")
+			return
+		}
+
+		commitId, err := qtx.InsertCommit(ctx, sqlcgen.InsertCommitParams{
+			Projectid: int32(projectId),
+			Userid:    userId,
+			Comment:   "Promoting branch " + request.Name,
+			Numfiles:  int32(len(output.Changes))})
+		if err != nil {
+			log.Error("db couldn't create commit", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		err = insertRestoreChanges(ctx, qtx, projectId, commitId, output.Changes)
+		if err != nil {
+			log.Error("couldn't replay branch", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		output.CommitId = int(commitId)
+	}
+
+	// the branch carries on from main's new head
+	err = qtx.SetBranchPromoted(ctx, sqlcgen.SetBranchPromotedParams{
+		Branchid:   branch.Branchid,
+		Basecommit: int32(output.CommitId),
+		Promoted:   branchHead,
+	})
+	if err != nil {
+		log.Error("couldn't update branch", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	err = writeAuditLog(ctx, qtx, projectId, userId, "branch-promote", map[string]any{
+		"branch":      request.Name,
+		"mode":        output.Mode,
+		"branch_head": branchHead,
+		"commit_id":   output.CommitId,
+	})
+	if err != nil {
+		log.Error("couldn't write audit log", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	tx.Commit(ctx)
+
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+// the changes that put the branch's versions of paths onto main.
+// only the paths the branch changed, everything else stays as main has it
+func replayChanges(main map[string]sqlcgen.GetLatestRevisionsAtCommitRow, branch map[string]sqlcgen.GetLatestRevisionsAtCommitRow, paths []string) []RestoreChange {
+	return diffRevisions(filterRevisions(main, paths), filterRevisions(branch, paths))
+}
+
+// keeps only the given paths
+func filterRevisions(revisions map[string]sqlcgen.GetLatestRevisionsAtCommitRow, paths []string) map[string]sqlcgen.GetLatestRevisionsAtCommitRow {
+	filtered := make(map[string]sqlcgen.GetLatestRevisionsAtCommitRow, len(paths))
+	for _, path := range paths {
+		if revision, ok := revisions[path]; ok {
+			filtered[path] = revision
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+)
+
+func TestReplayChanges(t *testing.T) {
+	type revisions = map[string]sqlcgen.GetLatestRevisionsAtCommitRow
+	rev := func(hash string, changetype int32) sqlcgen.GetLatestRevisionsAtCommitRow {
+		return sqlcgen.GetLatestRevisionsAtCommitRow{Filehash: hash, Changetype: changetype, Numchunks: 1}
+	}
+	// main has moved on since the branch split off: it added "m" and changed "shared"
+	main := revisions{
+		"shared":  rev("2", ChangeTypeModify),
+		"m":       rev("3", ChangeTypeCreate),
+		"edited":  rev("1", ChangeTypeCreate),
+		"removed": rev("1", ChangeTypeCreate),
+	}
+	branch := revisions{
+		"shared":  rev("1", ChangeTypeCreate),
+		"edited":  rev("4", ChangeTypeModify),
+		"removed": rev("1", ChangeTypeDelete),
+		"added":   rev("5", ChangeTypeCreate),
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  []RestoreChange
+	}{
+		{"nothing changed", []string{}, []RestoreChange{}},
+		{
+			// main's own changes to "shared" and "m" aren't touched
+			"branch changes",
+			[]string{"edited", "removed", "added"},
+			[]RestoreChange{
+				{Path: "added", FileHash: "5", ChangeType: ChangeTypeCreate, NumChunks: 1},
+				{Path: "edited", FileHash: "4", ChangeType: ChangeTypeModify, NumChunks: 1},
+				{Path: "removed", FileHash: "1", ChangeType: ChangeTypeDelete},
+			},
+		},
+		{"unknown path", []string{"missing"}, []RestoreChange{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := replayChanges(main, branch, test.paths); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("replayChanges() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -3,16 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/charmbracelet/log"
-	"github.com/clerk/clerk-sdk-go/v2"
-	"github.com/clerk/clerk-sdk-go/v2/user"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
 	"github.com/joshtenorio/glassypdm-server/internal/dal"
 	"github.com/joshtenorio/glassypdm-server/internal/observer"
 	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
@@ -34,7 +35,7 @@ changetype
 */
 func CreateCommit(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -60,8 +61,69 @@ func CreateCommit(w http.ResponseWriter, r *http.Request) {
 		WriteCustomError(w, "no permission")
 		return
 	}
+	// commits go to main unless they name a branch
+	branch, err := resolveBranch(ctx, request.ProjectId, request.Branch)
+	if err != nil {
+		log.Warn("invalid branch", "branch", request.Branch, "project", request.ProjectId)
+		WriteCustomError(w, "invalid branch")
+		return
+	}
+	// the parent is the commit number the client's changes are based on, every project
+	// starts with an initial commit so there's always one to send
+	if request.ParentCommit <= 0 {
+		WriteCustomError(w, "invalid parent commit")
+		return
+	}
+	parentId, err := dal.Queries.GetCommitIdFromNo(ctx, sqlcgen.GetCommitIdFromNoParams{
+		Projectid: int32(request.ProjectId),
+		Cno:       pgtype.Int4{Valid: true, Int32: int32(request.ParentCommit)},
+	})
+	if err != nil {
+		log.Warn("invalid parent commit", "parent", request.ParentCommit, "project", request.ProjectId)
+		WriteCustomError(w, "invalid parent commit")
+		return
+	}
+	if err := validateCommitFiles(request.Files); err != nil {
+		log.Warn("invalid commit files", "err", err.Error())
+		WriteCustomError(w, err.Error())
+		return
+	}
 	start := time.Now()
 
+	teamId, err := dal.Queries.GetTeamByProject(ctx, int32(request.ProjectId))
+	if err != nil {
+		log.Error("couldn't get team", "project", request.ProjectId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	// make sure every file has all of its chunks uploaded by the team before we accept the commit
+	numChunks, missingFiles, err := findMissingChunks(ctx, teamId, request.Files)
+	if err != nil {
+		log.Error("couldn't check file chunks", "db err", err)
+		observer.PostHogClient.Enqueue(posthog.Capture{
+			DistinctId: userId,
+			Event:      "commit-failed",
+			Properties: posthog.NewProperties().Set("failure-type", "db chunk lookup"),
+		})
+		WriteCustomError(w, "db error")
+		return
+	}
+	if len(missingFiles) > 0 {
+		log.Warn("found missing hashes", "len", len(missingFiles))
+		observer.PostHogClient.Enqueue(posthog.Capture{
+			DistinctId: userId,
+			Event:      "commit-failed",
+			Properties: posthog.NewProperties().
+				Set("failure-type", "missing hashes").
+				Set("numberHashesMissing", len(missingFiles)),
+		})
+		// respond with nb
+		missing_bytes, _ := json.Marshal(missingFiles)
+		PrintResponse(w, "nb", string(missing_bytes))
+		return
+	}
+
 	tx, err := dal.DbPool.Begin(ctx)
 	if err != nil {
 		log.Error("couldn't create transaction", "error", err)
@@ -75,12 +137,159 @@ func CreateCommit(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback(ctx)
 	qtx := dal.Queries.WithTx(tx)
+
+	// hold the project lock until we commit so nobody else can slip in a commit
+	// between checking for conflicts and inserting ours
+	err = qtx.LockProjectForCommit(ctx, int32(request.ProjectId))
+	if err != nil {
+		log.Error("couldn't lock project", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	paths := commitPaths(request.Files)
+
+	// reject if someone else has any of the paths checked out
+	locks, err := findLocksHeldByOthers(ctx, qtx, request.ProjectId, userId, paths)
+	if err != nil {
+		log.Error("couldn't check file locks", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	if len(locks) > 0 {
+		log.Warn("commit touches files locked by other users", "project", request.ProjectId, "len", len(locks))
+		observer.PostHogClient.Enqueue(posthog.Capture{
+			DistinctId: userId,
+			Event:      "commit-failed",
+			Properties: posthog.NewProperties().
+				Set("failure-type", "locked").
+				Set("numberLocked", len(locks)),
+		})
+		output_bytes, _ := json.Marshal(LockConflictOutput{Locks: locks})
+		PrintResponse(w, "locked", string(output_bytes))
+		return
+	}
+
+	// the parent has to be on the way to the branch's head: one of the branch's own commits,
+	// or main up to where the branch carries on from it
+	head, err := getBranchHead(ctx, qtx, request.ProjectId, branch.Branchid)
+	if err != nil {
+		log.Error("couldn't get latest commit", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	isAncestor, err := qtx.IsAncestorCommit(ctx, sqlcgen.IsAncestorCommitParams{
+		Projectid:  int32(request.ProjectId),
+		HeadCommit: head,
+		Commitid:   parentId,
+	})
+	if err != nil {
+		log.Error("couldn't check parent commit", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	if !isAncestor {
+		// after a replay promote the branch carries on from main's new commit, so a client still
+		// on the branch's old head has to sync to the new one first
+		rebase, err := isPromotedBefore(ctx, qtx, request.ProjectId, branch.Branchid, parentId)
+		if err != nil {
+			log.Error("couldn't check parent commit", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		if rebase {
+			headInfo, err := qtx.GetCommitInfo(ctx, head)
+			if err != nil {
+				log.Error("couldn't get latest commit", "db err", err)
+				WriteCustomError(w, "db error")
+				return
+			}
+			log.Warn("parent commit is from before the branch was promoted", "parent", request.ParentCommit, "branch", branch.Branchid, "project", request.ProjectId)
+			output_bytes, _ := json.Marshal(CommitRebaseOutput{ParentCommit: request.ParentCommit, HeadCommit: int(headInfo.Cno.Int32)})
+			PrintResponse(w, "rebase", string(output_bytes))
+			return
+		}
+		log.Warn("parent commit isn't on the branch", "parent", request.ParentCommit, "branch", branch.Branchid, "project", request.ProjectId)
+		WriteCustomError(w, "invalid parent commit")
+		return
+	}
+
+	// reject if any path was changed on the branch after the parent commit
+	conflicts, err := qtx.FindConflictingPaths(ctx, sqlcgen.FindConflictingPathsParams{
+		Projectid:    int32(request.ProjectId),
+		ParentCommit: parentId,
+		Paths:        paths,
+		HeadCommit:   head,
+	})
+	if err != nil {
+		log.Error("couldn't check for conflicts", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	if len(conflicts) > 0 {
+		headInfo, err := qtx.GetCommitInfo(ctx, head)
+		if err != nil {
+			log.Error("couldn't get latest commit", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		log.Warn("commit conflicts with newer revisions", "project", request.ProjectId, "len", len(conflicts))
+		observer.PostHogClient.Enqueue(posthog.Capture{
+			DistinctId: userId,
+			Event:      "commit-failed",
+			Properties: posthog.NewProperties().
+				Set("failure-type", "conflict").
+				Set("numberConflicts", len(conflicts)),
+		})
+		output := CommitConflictOutput{ParentCommit: request.ParentCommit, HeadCommit: int(headInfo.Cno.Int32), Paths: conflicts}
+		output_bytes, _ := json.Marshal(output)
+		PrintResponse(w, "conflict", string(output_bytes))
+		return
+	}
+
+	// renames have to move a file that exists at the parent onto a path that doesn't,
+	// anything changed since then was already caught as a conflict
+	parentState := make(map[string]sqlcgen.GetLatestRevisionsAtCommitRow)
+	for _, file := range request.Files {
+		if file.ChangeType != ChangeTypeRename {
+			continue
+		}
+		for _, path := range []string{file.OldPath, file.Path} {
+			revision, err := qtx.GetFileRevisionAtCommit(ctx, sqlcgen.GetFileRevisionAtCommitParams{
+				Projectid: int32(request.ProjectId),
+				Path:      path,
+				Commitid:  parentId,
+			})
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			} else if err != nil {
+				log.Error("couldn't get file revision", "db err", err)
+				WriteCustomError(w, "db error")
+				return
+			}
+			parentState[path] = sqlcgen.GetLatestRevisionsAtCommitRow(revision)
+		}
+	}
+	invalidRenames := findInvalidRenames(request.Files, parentState)
+	if len(invalidRenames.Missing) > 0 || len(invalidRenames.Existing) > 0 {
+		log.Warn("commit has invalid renames", "project", request.ProjectId, "missing", len(invalidRenames.Missing), "existing", len(invalidRenames.Existing))
+		observer.PostHogClient.Enqueue(posthog.Capture{
+			DistinctId: userId,
+			Event:      "commit-failed",
+			Properties: posthog.NewProperties().Set("failure-type", "invalid rename"),
+		})
+		output_bytes, _ := json.Marshal(invalidRenames)
+		PrintResponse(w, "rename", string(output_bytes))
+		return
+	}
+
 	// make commit, get new commitid
 	cid, err := qtx.InsertCommit(ctx, sqlcgen.InsertCommitParams{
 		Projectid: int32(request.ProjectId),
 		Userid:    userId,
 		Comment:   request.Message,
-		Numfiles:  int32(len(request.Files))})
+		Numfiles:  int32(len(request.Files)),
+		Branchid:  branch.Branchid})
 	if err != nil {
 		log.Error("db couldn't create commit", "db err", err)
 		observer.PostHogClient.Enqueue(posthog.Capture{
@@ -92,66 +301,87 @@ func CreateCommit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var hashesMissing []string
-	//for _, file := range request.Files {
-	for i := 0; i < len(request.Files); i += 2 {
+	// renames are inserted on their own after everything else
+	var files, renames []File
+	for _, file := range request.Files {
+		if file.ChangeType == ChangeTypeRename {
+			renames = append(renames, file)
+		} else {
+			files = append(files, file)
+		}
+	}
 
-		// FIXME these dont add numchunks
-		if i+1 >= len(request.Files) {
+	// insert two file revisions at a time
+	for i := 0; i < len(files); i += 2 {
+		if i+1 >= len(files) {
 			err = qtx.InsertFileRevision(ctx, sqlcgen.InsertFileRevisionParams{
 				Projectid:  int32(request.ProjectId),
-				Path:       request.Files[i].Path,
+				Path:       files[i].Path,
 				Commitid:   cid,
-				Filehash:   request.Files[i].Hash,
-				Changetype: int32(request.Files[i].ChangeType)})
+				Filehash:   files[i].Hash,
+				Numchunks:  numChunks[files[i].Hash],
+				Changetype: int32(files[i].ChangeType)})
 		} else {
 			err = qtx.InsertTwoFileRevisions(ctx, sqlcgen.InsertTwoFileRevisionsParams{
 				Projectid:    int32(request.ProjectId),
-				Path:         request.Files[i].Path,
+				Path:         files[i].Path,
 				Commitid:     cid,
-				Filehash:     request.Files[i].Hash,
-				Changetype:   int32(request.Files[i].ChangeType),
+				Filehash:     files[i].Hash,
+				Numchunks:    numChunks[files[i].Hash],
+				Changetype:   int32(files[i].ChangeType),
 				Projectid_2:  int32(request.ProjectId),
-				Path_2:       request.Files[i+1].Path,
+				Path_2:       files[i+1].Path,
 				Commitid_2:   cid,
-				Filehash_2:   request.Files[i+1].Hash,
-				Changetype_2: int32(request.Files[i+1].ChangeType)})
+				Filehash_2:   files[i+1].Hash,
+				Numchunks_2:  numChunks[files[i+1].Hash],
+				Changetype_2: int32(files[i+1].ChangeType)})
 		}
 
 		if err != nil {
-			if strings.Contains(err.Error(), "FOREIGN KEY constraint failed") || strings.Contains(err.Error(), "foreign key mismatch") {
-				// TODO error handling here isnt very ergonomic i think
-				hashesMissing = append(hashesMissing, request.Files[i].Hash)
-				hashesMissing = append(hashesMissing, request.Files[i+1].Hash)
-				continue
-			} else {
-				log.Error("now-handled error inserting file revision", "db", err)
-				observer.PostHogClient.Enqueue(posthog.Capture{
-					DistinctId: userId,
-					Event:      "commit-failed",
-					Properties: posthog.NewProperties().Set("failure-type", "db filerevision insert"),
-				})
-				WriteCustomError(w, "db error")
-				return
-			}
+			log.Error("unhandled error inserting file revision", "db", err)
+			observer.PostHogClient.Enqueue(posthog.Capture{
+				DistinctId: userId,
+				Event:      "commit-failed",
+				Properties: posthog.NewProperties().Set("failure-type", "db filerevision insert"),
+			})
+			WriteCustomError(w, "db error")
+			return
+		}
+	}
+
+	// the renamed file first so it picks up the old path's revision numbers,
+	// then the delete for the old path
+	for _, file := range renames {
+		err = qtx.InsertRenameRevision(ctx, sqlcgen.InsertRenameRevisionParams{
+			Projectid: int32(request.ProjectId),
+			Path:      file.Path,
+			Commitid:  cid,
+			Filehash:  file.Hash,
+			Numchunks: numChunks[file.Hash],
+			Oldpath:   file.OldPath})
+		// the delete keeps what the old path held before the rename, not the new contents
+		if err == nil {
+			err = qtx.InsertFileRevision(ctx, sqlcgen.InsertFileRevisionParams{
+				Projectid:  int32(request.ProjectId),
+				Path:       file.OldPath,
+				Commitid:   cid,
+				Filehash:   parentState[file.OldPath].Filehash,
+				Numchunks:  0,
+				Changetype: ChangeTypeDelete})
+		}
+		if err != nil {
+			log.Error("unhandled error inserting rename", "db", err)
+			observer.PostHogClient.Enqueue(posthog.Capture{
+				DistinctId: userId,
+				Event:      "commit-failed",
+				Properties: posthog.NewProperties().Set("failure-type", "db filerevision insert"),
+			})
+			WriteCustomError(w, "db error")
+			return
 		}
 	}
 	durationOne := time.Since(start)
 	log.Info("iterating took " + durationOne.String() + " over " + fmt.Sprint(len(request.Files)) + " files")
-	hashes_bytes, _ := json.Marshal(hashesMissing)
-	if len(hashesMissing) > 0 {
-		log.Warn("found missing hashes", "len", len(hashesMissing))
-		observer.PostHogClient.Enqueue(posthog.Capture{
-			DistinctId: userId,
-			Event:      "commit-failed",
-			Properties: posthog.NewProperties().
-				Set("failure-type", "missing hashes").
-				Set("numberHashesMissing", len(hashesMissing)),
-		})
-		// respond with nb
-		PrintResponse(w, "nb", string(hashes_bytes))
-		return
-	}
 
 	// no hashes missing, so commit the transaction
 	// we should consider returning more info too
@@ -173,7 +403,144 @@ type CreateCommitOutput struct {
 	CommitId int `json:"commit_id"`
 }
 
-// input: query offset=<number>
+type CommitConflictOutput struct {
+	ParentCommit int      `json:"parent_commit"` // commit numbers
+	HeadCommit   int      `json:"head_commit"`
+	Paths        []string `json:"paths"` // paths changed since the parent commit
+}
+
+// the branch was promoted since the parent commit, the client has to sync to head_commit and commit again
+type CommitRebaseOutput struct {
+	ParentCommit int `json:"parent_commit"` // commit numbers
+	HeadCommit   int `json:"head_commit"`
+}
+
+type RenameConflictOutput struct {
+	Missing  []string `json:"missing"`  // old paths that don't exist at the parent commit
+	Existing []string `json:"existing"` // new paths that already exist at the parent commit
+}
+
+type MissingFile struct {
+	FileHash      string `json:"file_hash"`
+	NumChunks     int    `json:"num_chunks"`     // 0 if nothing was uploaded for the file
+	MissingChunks []int  `json:"missing_chunks"` // empty if nothing was uploaded for the file
+}
+
+// every path the commit touches, renames touch their old path too.
+// these are checked for locks and conflicts
+func commitPaths(files []File) []string {
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+		if file.ChangeType == ChangeTypeRename {
+			paths = append(paths, file.OldPath)
+		}
+	}
+	return paths
+}
+
+// checks that every file has a known changetype, renames say where they came from,
+// and no path is changed twice in one commit
+func validateCommitFiles(files []File) error {
+	seen := make(map[string]bool)
+	for _, file := range files {
+		switch file.ChangeType {
+		case ChangeTypeCreate, ChangeTypeModify, ChangeTypeDelete:
+			if file.OldPath != "" {
+				return errors.New("old path is only for renames")
+			}
+		case ChangeTypeRename:
+			if file.OldPath == "" || file.OldPath == file.Path {
+				return errors.New("invalid rename")
+			}
+		default:
+			return errors.New("invalid changetype")
+		}
+
+		changed := []string{file.Path}
+		if file.ChangeType == ChangeTypeRename {
+			changed = append(changed, file.OldPath)
+		}
+		for _, path := range changed {
+			if seen[path] {
+				return errors.New("duplicate path")
+			}
+			seen[path] = true
+		}
+	}
+	return nil
+}
+
+// returns the renames whose old path doesn't exist in state, or whose new path already does
+func findInvalidRenames(files []File, state map[string]sqlcgen.GetLatestRevisionsAtCommitRow) RenameConflictOutput {
+	output := RenameConflictOutput{Missing: make([]string, 0), Existing: make([]string, 0)}
+	live := func(path string) bool {
+		revision, ok := state[path]
+		return ok && revision.Changetype != ChangeTypeDelete
+	}
+	for _, file := range files {
+		if file.ChangeType != ChangeTypeRename {
+			continue
+		}
+		if !live(file.OldPath) {
+			output.Missing = append(output.Missing, file.OldPath)
+		}
+		if live(file.Path) {
+			output.Existing = append(output.Existing, file.Path)
+		}
+	}
+	return output
+}
+
+// checks that chunks 0..numchunks-1 exist for every file that isn't being deleted,
+// only counting chunks whose block the team has.
+// returns the number of chunks for each complete file, and the files that are incomplete
+func findMissingChunks(ctx context.Context, teamId int32, files []File) (map[string]int32, []MissingFile, error) {
+	var hashes []string
+	for _, file := range files {
+		if file.ChangeType != ChangeTypeDelete {
+			hashes = append(hashes, file.Hash)
+		}
+	}
+
+	rows, err := dal.Queries.ListFileChunkIndexes(ctx, sqlcgen.ListFileChunkIndexesParams{Teamid: teamId, Filehashes: hashes})
+	if err != nil {
+		return nil, nil, err
+	}
+	numChunks := make(map[string]int32)
+	present := make(map[string]map[int32]bool)
+	for _, row := range rows {
+		if present[row.Filehash] == nil {
+			present[row.Filehash] = make(map[int32]bool)
+		}
+		present[row.Filehash][row.Chunkindex] = true
+		if row.Numchunks > numChunks[row.Filehash] {
+			numChunks[row.Filehash] = row.Numchunks
+		}
+	}
+
+	missingFiles := make([]MissingFile, 0)
+	checked := make(map[string]bool)
+	for _, hash := range hashes {
+		if checked[hash] {
+			continue
+		}
+		checked[hash] = true
+
+		missing := MissingFile{FileHash: hash, NumChunks: int(numChunks[hash]), MissingChunks: make([]int, 0)}
+		for i := int32(0); i < numChunks[hash]; i++ {
+			if !present[hash][i] {
+				missing.MissingChunks = append(missing.MissingChunks, int(i))
+			}
+		}
+		if numChunks[hash] == 0 || len(missing.MissingChunks) > 0 {
+			missingFiles = append(missingFiles, missing)
+		}
+	}
+	return numChunks, missingFiles, nil
+}
+
+// input: query offset=<number>, optionally branch=<name>
 // returns:
 // {
 // # of commits
@@ -196,7 +563,7 @@ type CommitList struct {
 
 func GetCommits(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -226,15 +593,22 @@ func GetCommits(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// main unless a branch is given
+	branch, err := resolveBranch(ctx, pid, r.URL.Query().Get("branch"))
+	if err != nil {
+		WriteCustomError(w, "invalid branch")
+		return
+	}
+
 	// get commits
-	CommitDto, err := dal.Queries.ListProjectCommits(ctx, sqlcgen.ListProjectCommitsParams{Projectid: int32(pid), Offset: int32(offset), Limit: 8})
+	CommitDto, err := dal.Queries.ListProjectCommits(ctx, sqlcgen.ListProjectCommitsParams{Projectid: int32(pid), Offset: int32(offset), Limit: 8, Branchid: branch.Branchid})
 	if err != nil {
 		log.Error("db error", "sql", err.Error())
 		WriteCustomError(w, "db error")
 		return
 	}
 	// get total number
-	NumCommits, err := dal.Queries.CountProjectCommits(ctx, int32(pid))
+	NumCommits, err := dal.Queries.CountProjectCommits(ctx, sqlcgen.CountProjectCommitsParams{Projectid: int32(pid), Branchid: branch.Branchid})
 	if err != nil {
 		log.Error("db error", "sql", err.Error())
 		WriteCustomError(w, "db error")
@@ -243,15 +617,15 @@ func GetCommits(w http.ResponseWriter, r *http.Request) {
 
 	var CommitDescriptions []CommitDescription
 	for _, Commit := range CommitDto {
-		// get author from clerk + userid
-		usr, err := user.Get(ctx, Commit.Userid)
+		// get author from the user directory + userid
+		usr, ok := GetUserByID(Commit.Userid)
 		name := ""
-		if err != nil {
+		if !ok {
 			log.Error("user invalid", "userid", Commit.Userid)
 			WriteCustomError(w, "invalid user id")
 			return
 		}
-		name = *usr.FirstName + " " + *usr.LastName
+		name = usr.Name
 
 		CommitDescriptions = append(CommitDescriptions, CommitDescription{
 			CommitId:     int(Commit.Commitid),
@@ -274,7 +648,7 @@ func GetCommits(w http.ResponseWriter, r *http.Request) {
 
 func GetCommitInformation(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -318,14 +692,14 @@ func GetCommitInformation(w http.ResponseWriter, r *http.Request) {
 	var Output CommitInformation
 	Output.FilesChanged = Files
 
-	usr, err := user.Get(ctx, CommitInfoDto.Userid)
+	usr, ok := GetUserByID(CommitInfoDto.Userid)
 	name := ""
-	if err != nil {
+	if !ok {
 		log.Error("user invalid", "userid", CommitInfoDto.Userid)
 		WriteCustomError(w, "invalid user id")
 		return
 	}
-	name = *usr.FirstName + " " + *usr.LastName
+	name = usr.Name
 
 	Output.Description = CommitDescription{
 		CommitId:     CommitId,
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+)
+
+func TestValidateCommitFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []File
+		want  string // "" if the files are valid
+	}{
+		{"empty", []File{}, ""},
+		{
+			"every changetype",
+			[]File{
+				{Path: "a", Hash: "1", ChangeType: ChangeTypeCreate},
+				{Path: "b", Hash: "2", ChangeType: ChangeTypeModify},
+				{Path: "c", Hash: "3", ChangeType: ChangeTypeDelete},
+				{Path: "d", Hash: "4", ChangeType: ChangeTypeRename, OldPath: "e"},
+			},
+			"",
+		},
+		{"unknown changetype", []File{{Path: "a", ChangeType: 0}}, "invalid changetype"},
+		{"old path on a modify", []File{{Path: "a", ChangeType: ChangeTypeModify, OldPath: "b"}}, "old path is only for renames"},
+		{"rename without old path", []File{{Path: "a", ChangeType: ChangeTypeRename}}, "invalid rename"},
+		{"rename onto itself", []File{{Path: "a", ChangeType: ChangeTypeRename, OldPath: "a"}}, "invalid rename"},
+		{
+			"same path twice",
+			[]File{{Path: "a", ChangeType: ChangeTypeCreate}, {Path: "a", ChangeType: ChangeTypeModify}},
+			"duplicate path",
+		},
+		{
+			"rename from a changed path",
+			[]File{{Path: "a", ChangeType: ChangeTypeModify}, {Path: "b", ChangeType: ChangeTypeRename, OldPath: "a"}},
+			"duplicate path",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateCommitFiles(test.files)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != test.want {
+				t.Errorf("validateCommitFiles() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindInvalidRenames(t *testing.T) {
+	type revisions = map[string]sqlcgen.GetLatestRevisionsAtCommitRow
+	state := revisions{
+		"live":    {Filehash: "1", Changetype: ChangeTypeCreate},
+		"live2":   {Filehash: "2", Changetype: ChangeTypeModify},
+		"deleted": {Filehash: "3", Changetype: ChangeTypeDelete},
+	}
+
+	tests := []struct {
+		name  string
+		files []File
+		want  RenameConflictOutput
+	}{
+		{"no renames", []File{{Path: "new", ChangeType: ChangeTypeCreate}}, RenameConflictOutput{Missing: []string{}, Existing: []string{}}},
+		{
+			"valid",
+			[]File{{Path: "new", ChangeType: ChangeTypeRename, OldPath: "live"}},
+			RenameConflictOutput{Missing: []string{}, Existing: []string{}},
+		},
+		{
+			"onto a deleted path",
+			[]File{{Path: "deleted", ChangeType: ChangeTypeRename, OldPath: "live"}},
+			RenameConflictOutput{Missing: []string{}, Existing: []string{}},
+		},
+		{
+			"old path never existed",
+			[]File{{Path: "new", ChangeType: ChangeTypeRename, OldPath: "nowhere"}},
+			RenameConflictOutput{Missing: []string{"nowhere"}, Existing: []string{}},
+		},
+		{
+			"old path deleted",
+			[]File{{Path: "new", ChangeType: ChangeTypeRename, OldPath: "deleted"}},
+			RenameConflictOutput{Missing: []string{"deleted"}, Existing: []string{}},
+		},
+		{
+			"onto a live path",
+			[]File{{Path: "live2", ChangeType: ChangeTypeRename, OldPath: "live"}},
+			RenameConflictOutput{Missing: []string{}, Existing: []string{"live2"}},
+		},
+		{
+			"both",
+			[]File{{Path: "live", ChangeType: ChangeTypeRename, OldPath: "deleted"}},
+			RenameConflictOutput{Missing: []string{"deleted"}, Existing: []string{"live"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := findInvalidRenames(test.files, state); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("findInvalidRenames() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCommitPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []File
+		want  []string
+	}{
+		{"empty", []File{}, nil},
+		{
+			"every changetype",
+			[]File{
+				{Path: "a", ChangeType: ChangeTypeCreate},
+				{Path: "b", ChangeType: ChangeTypeModify},
+				{Path: "c", ChangeType: ChangeTypeDelete},
+			},
+			[]string{"a", "b", "c"},
+		},
+		{
+			"rename touches old path",
+			[]File{{Path: "a", ChangeType: ChangeTypeModify}, {Path: "d", ChangeType: ChangeTypeRename, OldPath: "e"}},
+			[]string{"a", "d", "e"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := commitPaths(test.files); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("commitPaths() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
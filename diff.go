@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+	"lukechampine.com/blake3"
+)
+
+type DiffEntry struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"` // set for renames
+	Change  string `json:"change"`             // added, modified, renamed, or deleted
+	OldHash string `json:"old_hash"`
+	NewHash string `json:"new_hash"`
+	OldSize int    `json:"old_size"`
+	NewSize int    `json:"new_size"`
+}
+
+type DiffOutput struct {
+	From      int         `json:"from"` // commit numbers
+	To        int         `json:"to"`
+	Added     int         `json:"added"`
+	Modified  int         `json:"modified"`
+	Renamed   int         `json:"renamed"`
+	Deleted   int         `json:"deleted"`
+	Unchanged int         `json:"unchanged"`
+	Files     []DiffEntry `json:"files"`
+}
+
+// input: url param project-id, query from=<cno or tag>&to=<cno or tag>
+// returns what changed between two project updates
+func GetProjectDiff(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	if r.URL.Query().Get("from") == "" || r.URL.Query().Get("to") == "" {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+
+	if GetProjectPermissionByID(claims.Subject, projectId) < 1 {
+		log.Warn("insufficient permission", "user", claims.Subject, "projectId", projectId)
+		WriteCustomError(w, "insufficient permission")
+		return
+	}
+
+	// from and to can be commit numbers or tag names
+	fromCommit, from, err := resolveCommitRef(ctx, projectId, r.URL.Query().Get("from"))
+	if err != nil {
+		log.Warn("couldn't find commit", "ref", r.URL.Query().Get("from"), "project", projectId)
+		WriteCustomError(w, "invalid commit")
+		return
+	}
+	toCommit, to, err := resolveCommitRef(ctx, projectId, r.URL.Query().Get("to"))
+	if err != nil {
+		log.Warn("couldn't find commit", "ref", r.URL.Query().Get("to"), "project", projectId)
+		WriteCustomError(w, "invalid commit")
+		return
+	}
+	output, err := diffCommits(ctx, projectId, fromCommit, toCommit)
+	if err != nil {
+		log.Error("couldn't diff commits", "project", projectId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	output.From = from
+	output.To = to
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+// compares the project state at fromCommit with the state at toCommit.
+// the commits don't have to be on the same branch or in order, each side is the full state
+// as of that commit
+func diffCommits(ctx context.Context, projectId int, fromCommit int32, toCommit int32) (DiffOutput, error) {
+	from, err := getRevisionsAtCommit(ctx, &dal.Queries, projectId, fromCommit)
+	if err != nil {
+		return DiffOutput{}, err
+	}
+	to, err := getRevisionsAtCommit(ctx, &dal.Queries, projectId, toCommit)
+	if err != nil {
+		return DiffOutput{}, err
+	}
+	return diffStates(from, to), nil
+}
+
+// a path that was changed in between but ended up with the same hash counts as unchanged,
+// and a renamed file is one entry instead of a delete and an add
+func diffStates(from map[string]sqlcgen.GetLatestRevisionsAtCommitRow, to map[string]sqlcgen.GetLatestRevisionsAtCommitRow) DiffOutput {
+	output := DiffOutput{Files: make([]DiffEntry, 0)}
+	live := func(state map[string]sqlcgen.GetLatestRevisionsAtCommitRow, path string) bool {
+		revision, ok := state[path]
+		return ok && revision.Changetype != ChangeTypeDelete
+	}
+
+	// a rename only shows up as one if the from path existed in from
+	// and is gone in to, otherwise it's an add
+	renamedFrom := make(map[string]bool)
+	for path, revision := range to {
+		if revision.Changetype != ChangeTypeRename || !revision.Oldpath.Valid || live(from, path) {
+			continue
+		}
+		if live(from, revision.Oldpath.String) && !live(to, revision.Oldpath.String) {
+			renamedFrom[revision.Oldpath.String] = true
+		}
+	}
+
+	paths := make(map[string]bool, len(from)+len(to))
+	for path := range from {
+		paths[path] = true
+	}
+	for path := range to {
+		paths[path] = true
+	}
+	for path := range paths {
+		if renamedFrom[path] {
+			// reported with the path it was renamed to
+			continue
+		}
+		before, after := from[path], to[path]
+		existed, exists := live(from, path), live(to, path)
+		if !existed && exists && after.Changetype == ChangeTypeRename && renamedFrom[after.Oldpath.String] {
+			source := from[after.Oldpath.String]
+			output.Files = append(output.Files, DiffEntry{
+				Path:    path,
+				OldPath: after.Oldpath.String,
+				Change:  "renamed",
+				OldHash: source.Filehash,
+				NewHash: after.Filehash,
+				OldSize: int(source.Filesize),
+				NewSize: int(after.Filesize),
+			})
+			output.Renamed++
+			continue
+		}
+
+		entry := DiffEntry{Path: path}
+		if existed {
+			entry.OldHash = before.Filehash
+			entry.OldSize = int(before.Filesize)
+		}
+		if exists {
+			entry.NewHash = after.Filehash
+			entry.NewSize = int(after.Filesize)
+		}
+
+		switch {
+		case !existed && exists:
+			entry.Change = "added"
+			output.Added++
+		case existed && !exists:
+			entry.Change = "deleted"
+			output.Deleted++
+		case existed && exists && before.Filehash != after.Filehash:
+			entry.Change = "modified"
+			output.Modified++
+		case existed && exists:
+			output.Unchanged++
+			continue
+		default:
+			// not there on either side
+			continue
+		}
+		output.Files = append(output.Files, entry)
+	}
+
+	sort.Slice(output.Files, func(i, j int) bool {
+		return output.Files[i].Path < output.Files[j].Path
+	})
+	return output
+}
+
+type DeltaOutput struct {
+	Since      int                                       `json:"since"`       // commit number the client had
+	HeadCommit int                                       `json:"head_commit"` // commit id
+	HeadNo     int                                       `json:"head_no"`     // commit number
+	Digest     string                                    `json:"digest"`
+	Files      []sqlcgen.GetProjectDiffBetweenCommitsRow `json:"files"` // same format as project status
+}
+
+// input: url param project-id, query since=<cno or tag>, 0 for everything
+// returns the latest revision of every path changed after since, including deletions,
+// and a digest of the project state at the head commit
+func GetProjectDelta(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	ref := r.URL.Query().Get("since")
+	if ref == "" {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+
+	if GetProjectPermissionByID(claims.Subject, projectId) < 1 {
+		log.Warn("insufficient permission", "user", claims.Subject, "projectId", projectId)
+		WriteCustomError(w, "insufficient permission")
+		return
+	}
+
+	var sinceCommit int32
+	var since int
+	if ref != "0" {
+		sinceCommit, since, err = resolveCommitRef(ctx, projectId, ref)
+		if err != nil {
+			log.Warn("couldn't find commit", "ref", ref, "project", projectId)
+			WriteCustomError(w, "invalid commit")
+			return
+		}
+	}
+
+	// read everything from one snapshot so the digest matches the files
+	tx, err := dal.DbPool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	head, err := qtx.GetLatestCommit(ctx, int32(projectId))
+	if err != nil {
+		log.Error("couldn't get latest commit", "project", projectId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	info, err := qtx.GetCommitInfo(ctx, head)
+	if err != nil {
+		log.Error("couldn't get commit info", "commit", head, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	// a delta only adds up to the head state if since is on main's lineage,
+	// clients that were on a branch commit need a full sync
+	if sinceCommit != 0 {
+		isAncestor, err := qtx.IsAncestorCommit(ctx, sqlcgen.IsAncestorCommitParams{
+			Projectid:  int32(projectId),
+			HeadCommit: head,
+			Commitid:   sinceCommit,
+		})
+		if err != nil {
+			log.Error("couldn't check since commit", "project", projectId, "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		if !isAncestor {
+			WriteCustomError(w, "invalid commit")
+			return
+		}
+	}
+	files, err := qtx.GetProjectDiffBetweenCommits(ctx, sqlcgen.GetProjectDiffBetweenCommitsParams{
+		Projectid:  int32(projectId),
+		FromCommit: sinceCommit,
+		ToCommit:   head,
+	})
+	if err != nil {
+		log.Error("couldn't get changed files", "project", projectId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	state, err := getRevisionsAtCommit(ctx, qtx, projectId, head)
+	if err != nil {
+		log.Error("couldn't get project state", "project", projectId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	if files == nil {
+		files = make([]sqlcgen.GetProjectDiffBetweenCommitsRow, 0)
+	}
+	output := DeltaOutput{
+		Since:      since,
+		HeadCommit: int(head),
+		HeadNo:     int(info.Cno.Int32),
+		Digest:     stateDigest(state),
+		Files:      files,
+	}
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+/*
+digest of a project state so clients can check that they're in sync:
+hex blake3 (32 bytes) of "<path>\t<hash>\n" for every file that isn't deleted, sorted by path
+*/
+func stateDigest(state map[string]sqlcgen.GetLatestRevisionsAtCommitRow) string {
+	paths := make([]string, 0, len(state))
+	for path, revision := range state {
+		if revision.Changetype != ChangeTypeDelete {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	hasher := blake3.New(32, nil)
+	for _, path := range paths {
+		hasher.Write([]byte(path + "\t" + state[path].Filehash + "\n"))
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
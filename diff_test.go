@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+)
+
+func TestDiffStates(t *testing.T) {
+	type revisions = map[string]sqlcgen.GetLatestRevisionsAtCommitRow
+	rev := func(hash string, changetype int32) sqlcgen.GetLatestRevisionsAtCommitRow {
+		return sqlcgen.GetLatestRevisionsAtCommitRow{Filehash: hash, Changetype: changetype, Filesize: int32(len(hash))}
+	}
+	rename := func(hash string, oldPath string) sqlcgen.GetLatestRevisionsAtCommitRow {
+		revision := rev(hash, ChangeTypeRename)
+		revision.Oldpath = pgtype.Text{Valid: true, String: oldPath}
+		return revision
+	}
+
+	tests := []struct {
+		name   string
+		from   revisions
+		to     revisions
+		want   []DiffEntry
+		counts [5]int // added, modified, renamed, deleted, unchanged
+	}{
+		{"nothing", revisions{}, revisions{}, []DiffEntry{}, [5]int{}},
+		{
+			"added",
+			revisions{},
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			[]DiffEntry{{Path: "a", Change: "added", NewHash: "1", NewSize: 1}},
+			[5]int{1, 0, 0, 0, 0},
+		},
+		{
+			// e.g. from is a branch commit that added a file main never had
+			"only on from's side",
+			revisions{"a": rev("1", ChangeTypeCreate), "b": rev("22", ChangeTypeCreate)},
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			[]DiffEntry{{Path: "b", Change: "deleted", OldHash: "22", OldSize: 2}},
+			[5]int{0, 0, 0, 1, 1},
+		},
+		{
+			"deleted",
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			revisions{"a": rev("1", ChangeTypeDelete)},
+			[]DiffEntry{{Path: "a", Change: "deleted", OldHash: "1", OldSize: 1}},
+			[5]int{0, 0, 0, 1, 0},
+		},
+		{
+			"modified",
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			revisions{"a": rev("22", ChangeTypeModify)},
+			[]DiffEntry{{Path: "a", Change: "modified", OldHash: "1", NewHash: "22", OldSize: 1, NewSize: 2}},
+			[5]int{0, 1, 0, 0, 0},
+		},
+		{
+			"changed back",
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			revisions{"a": rev("1", ChangeTypeModify)},
+			[]DiffEntry{},
+			[5]int{0, 0, 0, 0, 1},
+		},
+		{
+			"deleted on both sides",
+			revisions{"a": rev("1", ChangeTypeDelete)},
+			revisions{"a": rev("1", ChangeTypeDelete)},
+			[]DiffEntry{},
+			[5]int{},
+		},
+		{
+			"renamed",
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			revisions{"a": rev("1", ChangeTypeDelete), "b": rename("22", "a")},
+			[]DiffEntry{{Path: "b", OldPath: "a", Change: "renamed", OldHash: "1", NewHash: "22", OldSize: 1, NewSize: 2}},
+			[5]int{0, 0, 1, 0, 0},
+		},
+		{
+			"renamed from a path that wasn't there",
+			revisions{},
+			revisions{"a": rev("1", ChangeTypeDelete), "b": rename("22", "a")},
+			[]DiffEntry{{Path: "b", Change: "added", NewHash: "22", NewSize: 2}},
+			[5]int{1, 0, 0, 0, 0},
+		},
+		{
+			"renamed before from",
+			revisions{"a": rev("1", ChangeTypeDelete), "b": rename("22", "a")},
+			revisions{"a": rev("1", ChangeTypeDelete), "b": rename("22", "a")},
+			[]DiffEntry{},
+			[5]int{0, 0, 0, 0, 1},
+		},
+		{
+			"sorted by path",
+			revisions{"c": rev("3", ChangeTypeCreate)},
+			revisions{"b": rev("2", ChangeTypeCreate), "a": rev("1", ChangeTypeCreate)},
+			[]DiffEntry{
+				{Path: "a", Change: "added", NewHash: "1", NewSize: 1},
+				{Path: "b", Change: "added", NewHash: "2", NewSize: 1},
+				{Path: "c", Change: "deleted", OldHash: "3", OldSize: 1},
+			},
+			[5]int{2, 0, 0, 1, 0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffStates(test.from, test.to)
+			if !reflect.DeepEqual(got.Files, test.want) {
+				t.Errorf("files = %+v, want %+v", got.Files, test.want)
+			}
+			counts := [5]int{got.Added, got.Modified, got.Renamed, got.Deleted, got.Unchanged}
+			if counts != test.counts {
+				t.Errorf("counts = %v, want %v", counts, test.counts)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+)
+
+type FileRevisionDescription struct {
+	Path           string `json:"path"`               // differs from the requested path before a rename
+	OldPath        string `json:"old_path,omitempty"` // set on renames
+	RevisionNumber int    `json:"revision_number"`
+	CommitId       int    `json:"commit_id"`
+	CommitNumber   int    `json:"commit_number"`
+	AuthorId       string `json:"author_id"`
+	Author         string `json:"author"`
+	Comment        string `json:"comment"`
+	Timestamp      int64  `json:"timestamp"`
+	Hash           string `json:"hash"`
+	Size           int    `json:"size"`
+	ChangeType     int    `json:"changetype"`
+}
+
+type FileHistory struct {
+	Path         string                    `json:"path"`
+	NumRevisions int                       `json:"num_revisions"`
+	Revisions    []FileRevisionDescription `json:"revisions"`
+}
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// input: url param project-id, query path=<path>&offset=<number>&limit=<number>
+// returns revisions of a file, newest first, including revisions from before it was renamed
+func GetFileHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	offset := 0
+	if r.URL.Query().Get("offset") != "" {
+		offset, err = strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil || offset < 0 {
+			WriteCustomError(w, "incorrect format")
+			return
+		}
+	}
+	limit := defaultHistoryLimit
+	if r.URL.Query().Get("limit") != "" {
+		limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			WriteCustomError(w, "incorrect format")
+			return
+		}
+		limit = min(limit, maxHistoryLimit)
+	}
+
+	if GetProjectPermissionByID(claims.Subject, projectId) < 1 {
+		WriteCustomError(w, "no permission")
+		return
+	}
+
+	revisions, err := dal.Queries.ListFileHistory(ctx, sqlcgen.ListFileHistoryParams{
+		Path:       path,
+		Projectid:  int32(projectId),
+		PageSize:   int32(limit),
+		PageOffset: int32(offset),
+	})
+	if err != nil {
+		log.Error("db error", "sql", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+	numRevisions, err := dal.Queries.CountFileRevisions(ctx, sqlcgen.CountFileRevisionsParams{
+		Path:      path,
+		Projectid: int32(projectId),
+	})
+	if err != nil {
+		log.Error("db error", "sql", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	// get every author on this page from the user directory at once
+	var authorIds []string
+	seen := make(map[string]bool)
+	for _, revision := range revisions {
+		if !seen[revision.Userid] {
+			seen[revision.Userid] = true
+			authorIds = append(authorIds, revision.Userid)
+		}
+	}
+	authors, err := GetUsersByIDs(authorIds)
+	if err != nil {
+		log.Error("couldn't get authors", "err", err.Error())
+		WriteCustomError(w, "clerk error")
+		return
+	}
+
+	output := FileHistory{Path: path, NumRevisions: int(numRevisions), Revisions: make([]FileRevisionDescription, 0, len(revisions))}
+	for _, revision := range revisions {
+		output.Revisions = append(output.Revisions, FileRevisionDescription{
+			Path:           revision.Path,
+			OldPath:        revision.Oldpath.String,
+			RevisionNumber: int(revision.Frno.Int32),
+			CommitId:       int(revision.Commitid),
+			CommitNumber:   int(revision.Cno.Int32),
+			AuthorId:       revision.Userid,
+			Author:         authors[revision.Userid].Name,
+			Comment:        revision.Comment,
+			Timestamp:      revision.Timestamp.Time.UnixNano() / 1000000000,
+			Hash:           revision.Filehash,
+			Size:           int(revision.Filesize),
+			ChangeType:     int(revision.Changetype),
+		})
+	}
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+type RestoreFileRequest struct {
+	Path           string `json:"path"`
+	CommitId       int    `json:"commit_id"`       // restore the file as it was at this commit,
+	RevisionNumber int    `json:"revision_number"` // or to this revision of the file
+}
+
+type RestoreFileOutput struct {
+	CommitId int           `json:"commit_id"`
+	Change   RestoreChange `json:"change"`
+}
+
+// input: url param project-id, body {path, commit_id or revision_number}
+// creates a new commit that puts a file back to an earlier revision.
+// the old revision's chunks are already stored, so nothing has to be uploaded
+func RestoreFile(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request RestoreFileRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Path == "" || (request.CommitId <= 0) == (request.RevisionNumber <= 0) {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	if GetProjectPermissionByID(userId, projectId) < 2 {
+		log.Warn("insufficient permission", "user", userId, "projectId", projectId)
+		WriteCustomError(w, "no permission")
+		return
+	}
+
+	// find the revision to restore
+	var source sqlcgen.GetLatestRevisionsAtCommitRow
+	var comment string
+	if request.CommitId > 0 {
+		// the restore goes on main, so the commit has to be from main too
+		info, err := dal.Queries.GetCommitInfo(ctx, int32(request.CommitId))
+		if err != nil || int(info.Projectid) != projectId || info.Branchid != 0 {
+			WriteCustomError(w, "invalid commit")
+			return
+		}
+		revision, err := dal.Queries.GetFileRevisionAtCommit(ctx, sqlcgen.GetFileRevisionAtCommitParams{
+			Projectid: int32(projectId),
+			Path:      request.Path,
+			Commitid:  int32(request.CommitId),
+		})
+		if err != nil {
+			WriteCustomError(w, "revision not found")
+			return
+		}
+		source = sqlcgen.GetLatestRevisionsAtCommitRow(revision)
+		comment = "Restoring " + request.Path + " to Project Update " + strconv.Itoa(int(info.Cno.Int32))
+	} else {
+		revision, err := dal.Queries.GetFileRevisionByNumber(ctx, sqlcgen.GetFileRevisionByNumberParams{
+			Projectid: int32(projectId),
+			Path:      request.Path,
+			Frno:      pgtype.Int4{Valid: true, Int32: int32(request.RevisionNumber)},
+		})
+		if err != nil {
+			WriteCustomError(w, "revision not found")
+			return
+		}
+		source = sqlcgen.GetLatestRevisionsAtCommitRow(revision)
+		comment = "Restoring " + request.Path + " to revision " + strconv.Itoa(request.RevisionNumber)
+	}
+
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	err = qtx.LockProjectForCommit(ctx, int32(projectId))
+	if err != nil {
+		log.Error("couldn't lock project", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	locks, err := findLocksHeldByOthers(ctx, qtx, projectId, userId, []string{request.Path})
+	if err != nil {
+		log.Error("couldn't check file locks", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	if len(locks) > 0 {
+		output_bytes, _ := json.Marshal(LockConflictOutput{Locks: locks})
+		PrintResponse(w, "locked", string(output_bytes))
+		return
+	}
+
+	// compare against the file as it is now
+	head, err := qtx.GetLatestCommit(ctx, int32(projectId))
+	if err != nil {
+		log.Error("couldn't get latest commit", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	current := make(map[string]sqlcgen.GetLatestRevisionsAtCommitRow)
+	revision, err := qtx.GetFileRevisionAtCommit(ctx, sqlcgen.GetFileRevisionAtCommitParams{
+		Projectid: int32(projectId),
+		Path:      request.Path,
+		Commitid:  head,
+	})
+	if err == nil {
+		current[request.Path] = sqlcgen.GetLatestRevisionsAtCommitRow(revision)
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		log.Error("couldn't get current file revision", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	changes := diffRevisions(current, map[string]sqlcgen.GetLatestRevisionsAtCommitRow{request.Path: source})
+	if len(changes) == 0 {
+		WriteCustomError(w, "nothing to restore")
+		return
+	}
+
+	commitId, err := qtx.InsertCommit(ctx, sqlcgen.InsertCommitParams{
+		Projectid: int32(projectId),
+		Userid:    userId,
+		Comment:   comment,
+		Numfiles:  int32(len(changes))})
+	if err != nil {
+		log.Error("db couldn't create commit", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	err = insertRestoreChanges(ctx, qtx, projectId, commitId, changes)
+	if err != nil {
+		log.Error("couldn't restore file", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	err = writeAuditLog(ctx, qtx, projectId, userId, "file-restore", map[string]any{
+		"path":            request.Path,
+		"restored_commit": request.CommitId,
+		"revision_number": request.RevisionNumber,
+		"new_commit":      int(commitId),
+		"changetype":      changes[0].ChangeType,
+	})
+	if err != nil {
+		log.Error("couldn't write audit log", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	tx.Commit(ctx)
+
+	output_bytes, _ := json.Marshal(RestoreFileOutput{CommitId: int(commitId), Change: changes[0]})
+	WriteSuccess(w, string(output_bytes))
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	clerkhttp "github.com/clerk/clerk-sdk-go/v2/http"
+	"github.com/clerk/clerk-sdk-go/v2/user"
+)
+
+// the most users Clerk returns per list request
+const clerkPageSize = 500
+
+// ClerkProvider checks Clerk session tokens and looks users up with the Clerk user API
+type ClerkProvider struct{}
+
+func NewClerkProvider(secretKey string) (*ClerkProvider, error) {
+	if secretKey == "" {
+		return nil, errors.New("clerk provider needs CLERK_SECRETKEY")
+	}
+	clerk.SetKey(secretKey)
+	return &ClerkProvider{}, nil
+}
+
+func (p *ClerkProvider) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withClaims := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims, ok := clerk.SessionClaimsFromContext(r.Context()); ok {
+				r = r.WithContext(WithClaims(r.Context(), Claims{Subject: claims.Subject}))
+			}
+			next.ServeHTTP(w, r)
+		})
+		return clerkhttp.WithHeaderAuthorization()(withClaims)
+	}
+}
+
+func (p *ClerkProvider) GetUser(ctx context.Context, userId string) (User, error) {
+	usr, err := user.Get(ctx, userId)
+	var apiErr *clerk.APIErrorResponse
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode == http.StatusNotFound {
+		return User{}, ErrUserNotFound
+	} else if err != nil {
+		return User{}, err
+	}
+	return clerkUser(usr), nil
+}
+
+func (p *ClerkProvider) GetUsers(ctx context.Context, userIds []string) (map[string]User, error) {
+	users := make(map[string]User)
+	for start := 0; start < len(userIds); start += clerkPageSize {
+		ids := userIds[start:min(start+clerkPageSize, len(userIds))]
+		res, err := user.List(ctx, &user.ListParams{
+			ListParams: clerk.ListParams{Limit: clerk.Int64(int64(len(ids)))},
+			UserIDs:    ids,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, usr := range res.Users {
+			users[usr.ID] = clerkUser(usr)
+		}
+	}
+	return users, nil
+}
+
+func (p *ClerkProvider) FindUserByEmail(ctx context.Context, email string) (User, error) {
+	res, err := user.List(ctx, &user.ListParams{EmailAddresses: []string{email}})
+	if err != nil {
+		return User{}, err
+	}
+	switch len(res.Users) {
+	case 0:
+		return User{}, ErrUserNotFound
+	case 1:
+		return clerkUser(res.Users[0]), nil
+	default:
+		return User{}, ErrAmbiguousEmail
+	}
+}
+
+func (p *ClerkProvider) ListUsers(ctx context.Context) ([]User, error) {
+	var users []User
+	for {
+		res, err := user.List(ctx, &user.ListParams{ListParams: clerk.ListParams{
+			Limit:  clerk.Int64(clerkPageSize),
+			Offset: clerk.Int64(int64(len(users))),
+		}})
+		if err != nil {
+			return nil, err
+		}
+		for _, usr := range res.Users {
+			users = append(users, clerkUser(usr))
+		}
+		if len(res.Users) < clerkPageSize || int64(len(users)) >= res.TotalCount {
+			return users, nil
+		}
+	}
+}
+
+func clerkUser(usr *clerk.User) User {
+	output := User{ID: usr.ID}
+	var names []string
+	if usr.FirstName != nil {
+		names = append(names, *usr.FirstName)
+	}
+	if usr.LastName != nil {
+		names = append(names, *usr.LastName)
+	}
+	output.Name = strings.Join(names, " ")
+	if usr.PrimaryEmailAddressID != nil {
+		output.EmailID = *usr.PrimaryEmailAddressID
+		for _, address := range usr.EmailAddresses {
+			if address.ID == output.EmailID {
+				output.Email = address.EmailAddress
+			}
+		}
+	}
+	return output
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+)
+
+// Sessions checks who is making a request and Users looks people up, both set up in main
+var Sessions Authenticator
+var Users UserDirectory
+
+var ErrUserNotFound = errors.New("user not found")
+
+// more than one account has the email, which Clerk allows for unverified addresses
+var ErrAmbiguousEmail = errors.New("more than one user has this email")
+
+const (
+	ProviderClerk = "clerk"
+	ProviderLocal = "local"
+)
+
+// Claims is who a request was made by
+type Claims struct {
+	Subject string // user id
+}
+
+type User struct {
+	ID      string
+	Name    string
+	Email   string
+	EmailID string // Clerk's id for the primary email address, the address itself for local users
+}
+
+// Authenticator verifies a request's session and puts its claims in the request context.
+// requests without a valid session are passed through without claims,
+// handlers respond with 401 if SessionClaimsFromContext comes up empty
+type Authenticator interface {
+	Middleware() func(http.Handler) http.Handler
+}
+
+// UserDirectory is where user names and emails come from
+type UserDirectory interface {
+	GetUser(ctx context.Context, userId string) (User, error)
+	// GetUsers looks up users in one go, ids that aren't found are left out
+	GetUsers(ctx context.Context, userIds []string) (map[string]User, error)
+	FindUserByEmail(ctx context.Context, email string) (User, error)
+	ListUsers(ctx context.Context) ([]User, error)
+}
+
+// Provider is an identity provider that's both, which is what NewFromEnv hands back
+type Provider interface {
+	Authenticator
+	UserDirectory
+}
+
+type claimsKey struct{}
+
+// WithClaims returns a context carrying claims, for Authenticators and for faking a session in tests
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func SessionClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	if !ok || claims.Subject == "" {
+		return Claims{}, false
+	}
+	return claims, true
+}
+
+// ProviderFromEnv is AUTH_PROVIDER, defaulting to clerk
+func ProviderFromEnv() string {
+	if provider := os.Getenv("AUTH_PROVIDER"); provider != "" {
+		return provider
+	}
+	return ProviderClerk
+}
+
+// NewFromEnv sets up the identity provider picked by AUTH_PROVIDER.
+// the returned provider is both the Authenticator and the UserDirectory
+func NewFromEnv() (Provider, error) {
+	switch ProviderFromEnv() {
+	case ProviderClerk:
+		return NewClerkProvider(os.Getenv("CLERK_SECRETKEY"))
+	case ProviderLocal:
+		return NewLocalProvider(os.Getenv("AUTH_JWT_SECRET"), os.Getenv("AUTH_TOKEN_LIFETIME"))
+	default:
+		return nil, errors.New("unknown auth provider")
+	}
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+const DefaultSessionLifetime = 24 * time.Hour
+
+// session tokens carry this scope so they can't be mixed up with store tokens
+const sessionScope = "session"
+
+// compared against when the email doesn't exist, so a login takes as long either way
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("glassypdm"), bcrypt.DefaultCost)
+	return hash
+})
+
+// LocalProvider keeps accounts in the localuser table and signs its own session tokens,
+// for servers that can't reach Clerk
+type LocalProvider struct {
+	tokenAuth *jwtauth.JWTAuth
+	lifetime  time.Duration
+}
+
+func NewLocalProvider(secret string, lifetime string) (*LocalProvider, error) {
+	if secret == "" {
+		// unlike store tokens, sessions need to survive a restart
+		return nil, errors.New("local provider needs AUTH_JWT_SECRET")
+	}
+	p := &LocalProvider{tokenAuth: jwtauth.New("HS256", []byte(secret), nil), lifetime: DefaultSessionLifetime}
+	if lifetime != "" {
+		duration, err := time.ParseDuration(lifetime)
+		if err != nil || duration <= 0 {
+			return nil, errors.New("AUTH_TOKEN_LIFETIME is not a valid duration")
+		}
+		p.lifetime = duration
+	}
+	return p, nil
+}
+
+func (p *LocalProvider) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := jwtauth.VerifyRequest(p.tokenAuth, r, jwtauth.TokenFromHeader)
+			if err == nil && token != nil {
+				if scope, _ := token.Get("scope"); scope == sessionScope && token.Subject() != "" {
+					r = r.WithContext(WithClaims(r.Context(), Claims{Subject: token.Subject()}))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Login checks an email and password and returns a session token for the account
+func (p *LocalProvider) Login(ctx context.Context, email string, password string) (string, time.Time, error) {
+	account, err := dal.Queries.GetLocalUserByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, pgx.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return "", time.Time{}, ErrInvalidCredentials
+	} else if err != nil {
+		return "", time.Time{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.Passwordhash), []byte(password)) != nil {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	expires := time.Now().Add(p.lifetime)
+	claims := map[string]interface{}{
+		"sub":   account.Userid,
+		"scope": sessionScope,
+	}
+	jwtauth.SetIssuedNow(claims)
+	jwtauth.SetExpiry(claims, expires)
+	_, token, err := p.tokenAuth.Encode(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+func (p *LocalProvider) GetUser(ctx context.Context, userId string) (User, error) {
+	account, err := dal.Queries.GetLocalUser(ctx, userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	} else if err != nil {
+		return User{}, err
+	}
+	return User{ID: account.Userid, Name: account.Name, Email: account.Email, EmailID: account.Email}, nil
+}
+
+func (p *LocalProvider) GetUsers(ctx context.Context, userIds []string) (map[string]User, error) {
+	users := make(map[string]User)
+	if len(userIds) == 0 {
+		return users, nil
+	}
+	accounts, err := dal.Queries.GetLocalUsers(ctx, userIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		users[account.Userid] = User{ID: account.Userid, Name: account.Name, Email: account.Email, EmailID: account.Email}
+	}
+	return users, nil
+}
+
+func (p *LocalProvider) FindUserByEmail(ctx context.Context, email string) (User, error) {
+	account, err := dal.Queries.GetLocalUserByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	} else if err != nil {
+		return User{}, err
+	}
+	return User{ID: account.Userid, Name: account.Name, Email: account.Email, EmailID: account.Email}, nil
+}
+
+func (p *LocalProvider) ListUsers(ctx context.Context) ([]User, error) {
+	accounts, err := dal.Queries.ListLocalUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]User, 0, len(accounts))
+	for _, account := range accounts {
+		users = append(users, User{ID: account.Userid, Name: account.Name, Email: account.Email, EmailID: account.Email})
+	}
+	return users, nil
+}
+
+// CreateLocalUser adds an account for the local provider and returns its user id
+func CreateLocalUser(ctx context.Context, email string, name string, password string) (string, error) {
+	if password == "" {
+		return "", errors.New("password can't be empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	raw := make([]byte, 12)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	userId := "user_" + hex.EncodeToString(raw)
+	err = dal.Queries.InsertLocalUser(ctx, sqlcgen.InsertLocalUserParams{
+		Userid:       userId,
+		Email:        normalizeEmail(email),
+		Name:         name,
+		Passwordhash: string(hash),
+	})
+	return userId, err
+}
+
+// SetLocalUserPassword changes the password of the local account with the email
+func SetLocalUserPassword(ctx context.Context, email string, password string) error {
+	if password == "" {
+		return errors.New("password can't be empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	updated, err := dal.Queries.SetLocalUserPassword(ctx, sqlcgen.SetLocalUserPasswordParams{Email: normalizeEmail(email), Passwordhash: string(hash)})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
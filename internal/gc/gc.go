@@ -0,0 +1,174 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jackc/pgx/v5"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/store"
+)
+
+// DefaultGracePeriod is how long unreferenced data is kept around so
+// uploads that haven't been committed yet don't get swept
+const DefaultGracePeriod = 72 * time.Hour
+
+// blocks are stored under their hex blake3 hash, and a team's copy of a block
+// that another team uploaded first under the hash plus "_team<id>" until it's checked.
+// anything else in the bucket belongs to someone else and is never swept
+var blockKeyPattern = regexp.MustCompile(`^[0-9a-f]{64}(_team[0-9]+)?$`)
+
+type Report struct {
+	DryRun         bool     `json:"dry_run"`
+	GracePeriod    string   `json:"grace_period"`
+	ChunksRemoved  int      `json:"chunks_removed"`
+	FileHashes     []string `json:"file_hashes"`
+	BlocksRemoved  int      `json:"blocks_removed"`
+	BlockHashes    []string `json:"block_hashes"`
+	ObjectsRemoved int      `json:"objects_removed"`
+	ObjectKeys     []string `json:"object_keys"`
+	BytesFreed     int64    `json:"bytes_freed"`
+}
+
+/*
+mark and sweep:
+- chunks whose filehash isn't referenced by any filerevision
+- blocks that aren't referenced by any chunk
+- objects in the blob store that have no block row at all, only if sweepObjects is set
+anything newer than the grace period is left alone
+*/
+func Run(ctx context.Context, grace time.Duration, dryRun bool, sweepObjects bool) (Report, error) {
+	report := Report{
+		DryRun:      dryRun,
+		GracePeriod: grace.String(),
+		FileHashes:  make([]string, 0),
+		BlockHashes: make([]string, 0),
+		ObjectKeys:  make([]string, 0),
+	}
+	graceSeconds := int32(grace.Seconds())
+
+	// sweep chunks
+	var chunkFiles []string
+	if dryRun {
+		chunks, err := dal.Queries.ListOrphanedChunks(ctx, graceSeconds)
+		if err != nil {
+			return report, err
+		}
+		for _, chunk := range chunks {
+			chunkFiles = append(chunkFiles, chunk.Filehash)
+		}
+	} else {
+		chunks, err := dal.Queries.DeleteOrphanedChunks(ctx, graceSeconds)
+		if err != nil {
+			return report, err
+		}
+		for _, chunk := range chunks {
+			chunkFiles = append(chunkFiles, chunk.Filehash)
+		}
+	}
+	report.ChunksRemoved = len(chunkFiles)
+	seenFiles := make(map[string]bool)
+	for _, filehash := range chunkFiles {
+		if !seenFiles[filehash] {
+			seenFiles[filehash] = true
+			report.FileHashes = append(report.FileHashes, filehash)
+		}
+	}
+
+	// sweep blocks
+	blocks, err := dal.Queries.ListOrphanedBlocks(ctx, graceSeconds)
+	if err != nil {
+		return report, err
+	}
+	for _, block := range blocks {
+		if !dryRun {
+			// the delete re-checks for referencing chunks, so a block that
+			// got picked up by an upload in the meantime is kept
+			key, err := dal.Queries.DeleteOrphanedBlock(ctx, block.Blockhash)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			} else if err != nil {
+				log.Error("couldn't remove block", "block", block.Blockhash, "db", err.Error())
+				continue
+			}
+			if err := store.Blobs.Delete(ctx, key); err != nil {
+				log.Error("couldn't remove block from blob store", "block", block.Blockhash, "store", err.Error())
+			}
+		}
+		report.BlocksRemoved++
+		report.BlockHashes = append(report.BlockHashes, block.Blockhash)
+		report.BytesFreed += int64(block.Blocksize)
+	}
+
+	if !sweepObjects {
+		return report, nil
+	}
+
+	// sweep objects that never made it into the block table
+	keys, err := dal.Queries.ListBlockKeys(ctx)
+	if err != nil {
+		return report, err
+	}
+	known := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		known[key] = true
+	}
+	objects, err := store.Blobs.List(ctx)
+	if err != nil {
+		return report, err
+	}
+	cutoff := time.Now().Add(-grace)
+	for _, object := range objects {
+		if known[object.Key] || object.LastModified.After(cutoff) || !blockKeyPattern.MatchString(object.Key) {
+			continue
+		}
+		if !dryRun {
+			// an upload of the same block may have finished since we listed the keys
+			exists, err := dal.Queries.BlockKeyExists(ctx, object.Key)
+			if err != nil {
+				log.Error("couldn't check block key", "key", object.Key, "db", err.Error())
+				continue
+			}
+			if exists {
+				continue
+			}
+			if err := store.Blobs.Delete(ctx, object.Key); err != nil {
+				log.Error("couldn't remove object from blob store", "key", object.Key, "store", err.Error())
+				continue
+			}
+		}
+		report.ObjectsRemoved++
+		report.ObjectKeys = append(report.ObjectKeys, object.Key)
+		report.BytesFreed += object.Size
+	}
+
+	return report, nil
+}
+
+// StartBackground runs garbage collection every interval until ctx is done
+func StartBackground(ctx context.Context, interval time.Duration, grace time.Duration, sweepObjects bool) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := Run(ctx, grace, false, sweepObjects)
+				if err != nil {
+					log.Error("garbage collection failed", "err", err.Error())
+					continue
+				}
+				log.Info("garbage collection finished",
+					"chunks", report.ChunksRemoved,
+					"blocks", report.BlocksRemoved,
+					"objects", report.ObjectsRemoved,
+					"bytes", report.BytesFreed)
+			}
+		}
+	}()
+}
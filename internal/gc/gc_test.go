@@ -0,0 +1,31 @@
+package gc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlockKeyPattern(t *testing.T) {
+	hash := strings.Repeat("0123456789abcdef", 4)
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{hash, true},
+		{hash + "_team1", true},
+		{hash + "_team42", true},
+		{strings.ToUpper(hash), false},
+		{hash[:63], false},
+		{hash + "0", false},
+		{hash + "_team", false},
+		{hash + "_teamx", false},
+		{hash + "_other1", false},
+		{"backups/" + hash, false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := blockKeyPattern.MatchString(test.key); got != test.want {
+			t.Errorf("blockKeyPattern.MatchString(%q) = %v, want %v", test.key, got, test.want)
+		}
+	}
+}
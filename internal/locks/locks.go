@@ -0,0 +1,48 @@
+package locks
+
+import (
+	"context"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+)
+
+// DefaultSweepInterval is how often expired locks are released
+// when LOCK_SWEEP_INTERVAL isn't set
+const DefaultSweepInterval = 10 * time.Minute
+
+// Sweep releases every lock past its expiry and returns how many were released
+func Sweep(ctx context.Context) (int, error) {
+	expired, err := dal.Queries.ExpireLocks(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, lock := range expired {
+		log.Debug("lock expired", "project", lock.Projectid, "path", lock.Path)
+	}
+	return len(expired), nil
+}
+
+// StartBackground sweeps expired locks every interval until ctx is done
+func StartBackground(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				released, err := Sweep(ctx)
+				if err != nil {
+					log.Error("lock sweep failed", "err", err.Error())
+					continue
+				}
+				if released > 0 {
+					log.Info("released expired locks", "locks", released)
+				}
+			}
+		}
+	}()
+}
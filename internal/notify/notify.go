@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sender is used to deliver invites, set up in main
+var Sender Notifier
+
+// Invite is what gets sent to someone invited to a team
+type Invite struct {
+	Email     string
+	TeamName  string
+	Role      string
+	Token     string
+	InvitedBy string
+	Expires   time.Time
+}
+
+// Notifier delivers messages to people who may not have an account yet
+type Notifier interface {
+	SendInvite(ctx context.Context, invite Invite) error
+}
+
+// NewFromEnv picks a notifier based on NOTIFY_BACKEND, defaulting to log
+// so invites work on servers that can't send email
+func NewFromEnv() (Notifier, error) {
+	switch os.Getenv("NOTIFY_BACKEND") {
+	case "smtp":
+		return NewSMTPNotifier(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("SMTP_FROM"),
+			os.Getenv("INVITE_URL"))
+	default:
+		return NewLogNotifier(os.Getenv("INVITE_URL")), nil
+	}
+}
+
+// link to accept the invite, "" if there's no invite url configured
+func inviteLink(inviteURL string, token string) string {
+	if inviteURL == "" {
+		return ""
+	}
+	sep := "?"
+	if strings.Contains(inviteURL, "?") {
+		sep = "&"
+	}
+	return inviteURL + sep + "token=" + url.QueryEscape(token)
+}
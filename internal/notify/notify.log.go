@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/charmbracelet/log"
+)
+
+// LogNotifier writes invites to the server log, an admin passes the token on by hand
+type LogNotifier struct {
+	inviteURL string
+}
+
+func NewLogNotifier(inviteURL string) *LogNotifier {
+	return &LogNotifier{inviteURL: inviteURL}
+}
+
+func (n *LogNotifier) SendInvite(ctx context.Context, invite Invite) error {
+	log.Info("team invite created",
+		"email", invite.Email,
+		"team", invite.TeamName,
+		"role", invite.Role,
+		"token", invite.Token,
+		"link", inviteLink(n.inviteURL, invite.Token),
+		"expires", invite.Expires)
+	return nil
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPNotifier emails invites through an SMTP server
+type SMTPNotifier struct {
+	addr      string
+	host      string
+	auth      smtp.Auth
+	from      string
+	inviteURL string
+}
+
+func NewSMTPNotifier(host string, port string, username string, password string, from string, inviteURL string) (*SMTPNotifier, error) {
+	if host == "" {
+		return nil, errors.New("smtp notifier needs a host")
+	}
+	if from == "" {
+		return nil, errors.New("smtp notifier needs a from address")
+	}
+	if port == "" {
+		port = "587"
+	}
+	n := &SMTPNotifier{
+		addr:      net.JoinHostPort(host, port),
+		host:      host,
+		from:      from,
+		inviteURL: inviteURL,
+	}
+	if username != "" {
+		n.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return n, nil
+}
+
+func (n *SMTPNotifier) SendInvite(ctx context.Context, invite Invite) error {
+	// the team name ends up in a header, don't let it add more
+	team := strings.NewReplacer("\r", " ", "\n", " ").Replace(invite.TeamName)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "You've been invited to join %s on glassyPDM as a %s.\r\n\r\n", team, strings.ToLower(invite.Role))
+	if link := inviteLink(n.inviteURL, invite.Token); link != "" {
+		fmt.Fprintf(&body, "Accept the invite here: %s\r\n\r\n", link)
+	}
+	fmt.Fprintf(&body, "Or sign in and enter this invite code: %s\r\n\r\n", invite.Token)
+	fmt.Fprintf(&body, "You'll need to sign in as %s to accept it. This invite expires %s.\r\n", invite.Email, invite.Expires.Format("January 2, 2006 15:04 MST"))
+
+	msg := "From: " + n.from + "\r\n" +
+		"To: " + invite.Email + "\r\n" +
+		"Subject: Invitation to join " + team + " on glassyPDM\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body.String()
+	return smtp.SendMail(n.addr, n.auth, n.from, []string{invite.Email}, []byte(msg))
+}
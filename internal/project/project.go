@@ -1,27 +1,103 @@
 package project
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
+	"time"
 
+	"github.com/charmbracelet/log"
 	"github.com/go-chi/jwtauth/v5"
 )
 
 var TokenAuth *jwtauth.JWTAuth
 
-func RouteStoreJWTRequest(w http.ResponseWriter, r *http.Request) {
-	RequestStoreJWT("asdf", 19, false)
+const (
+	StoreActionUpload   = "upload"
+	StoreActionDownload = "download"
+)
+
+// store tokens are short-lived; clients request a new one per transfer
+const StoreTokenLifetime = time.Hour
+
+// StoreClaims is what a store token is scoped to
+type StoreClaims struct {
+	UserID    string
+	ProjectID int
+	Action    string
 }
-func RequestStoreJWT(UserID string, ProjectID int, IsDownload bool) {
-	// TODO this should be in an init function
 
-	// check if user can upload/download to/from ProjectID
+func (c StoreClaims) IsDownload() bool {
+	return c.Action == StoreActionDownload
+}
+
+// RequestStoreJWT mints a store token for ProjectID.
+// the caller is responsible for checking that UserID can upload/download to/from ProjectID
+func RequestStoreJWT(UserID string, ProjectID int, IsDownload bool) (string, time.Time, error) {
+	action := StoreActionUpload
+	if IsDownload {
+		action = StoreActionDownload
+	}
+	expires := time.Now().Add(StoreTokenLifetime)
 
-	// create JWT if so, otherwise return false
 	// in JWT, include userID, projectID, and intended action
+	claims := map[string]interface{}{
+		"sub":        UserID,
+		"project_id": ProjectID,
+		"action":     action,
+	}
+	jwtauth.SetIssuedNow(claims)
+	jwtauth.SetExpiry(claims, expires)
+
+	_, token, err := TokenAuth.Encode(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
 }
 
 func InitStoreJWT(secret string) {
+	if secret == "" {
+		// tokens won't survive a restart, but they're short-lived anyways
+		log.Warn("STORE_JWT_SECRET is not set, generating a random secret")
+		key := make([]byte, 32)
+		rand.Read(key)
+		secret = hex.EncodeToString(key)
+	}
 
 	// initialize tokenauth
 	TokenAuth = jwtauth.New("HS256", []byte(secret), nil)
 }
+
+// StoreClaimsFromContext returns the claims of a verified store token, if the request had one
+func StoreClaimsFromContext(ctx context.Context) (StoreClaims, bool) {
+	token, claims, err := jwtauth.FromContext(ctx)
+	if err != nil || token == nil {
+		return StoreClaims{}, false
+	}
+
+	action, _ := claims["action"].(string)
+	// numbers come back from json as float64
+	projectId, ok := claims["project_id"].(float64)
+	if !ok || token.Subject() == "" || (action != StoreActionUpload && action != StoreActionDownload) {
+		return StoreClaims{}, false
+	}
+	return StoreClaims{UserID: token.Subject(), ProjectID: int(projectId), Action: action}, true
+}
+
+// WithStoreAuthorization lets requests with a valid store token through and sends
+// everything else through fallback, i.e. the session check.
+// needs jwtauth.Verifier(TokenAuth) to run first
+func WithStoreAuthorization(fallback func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withFallback := fallback(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := StoreClaimsFromContext(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			withFallback.ServeHTTP(w, r)
+		})
+	}
+}
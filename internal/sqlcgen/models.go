@@ -8,19 +8,40 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type Auditlog struct {
+	Auditid   int32            `json:"auditid"`
+	Projectid int32            `json:"projectid"`
+	Userid    string           `json:"userid"`
+	Action    string           `json:"action"`
+	Detail    string           `json:"detail"`
+	Timestamp pgtype.Timestamp `json:"timestamp"`
+}
+
 type Block struct {
-	Blockhash string `json:"blockhash"`
-	S3key     string `json:"s3key"`
-	Blocksize int32  `json:"blocksize"`
+	Blockhash string           `json:"blockhash"`
+	S3key     string           `json:"s3key"`
+	Blocksize int32            `json:"blocksize"`
+	Created   pgtype.Timestamp `json:"created"`
+}
+
+type Branch struct {
+	Branchid   int32            `json:"branchid"`
+	Projectid  int32            `json:"projectid"`
+	Name       string           `json:"name"`
+	Basecommit int32            `json:"basecommit"`
+	Promoted   int32            `json:"promoted"`
+	Userid     string           `json:"userid"`
+	Timestamp  pgtype.Timestamp `json:"timestamp"`
 }
 
 type Chunk struct {
-	Chunkindex int32  `json:"chunkindex"`
-	Numchunks  int32  `json:"numchunks"`
-	Filehash   string `json:"filehash"`
-	Blockhash  string `json:"blockhash"`
-	Blocksize  int32  `json:"blocksize"`
-	Filesize   int32  `json:"filesize"`
+	Chunkindex int32            `json:"chunkindex"`
+	Numchunks  int32            `json:"numchunks"`
+	Filehash   string           `json:"filehash"`
+	Blockhash  string           `json:"blockhash"`
+	Blocksize  int32            `json:"blocksize"`
+	Filesize   int32            `json:"filesize"`
+	Created    pgtype.Timestamp `json:"created"`
 }
 
 type Commit struct {
@@ -31,13 +52,18 @@ type Commit struct {
 	Numfiles  int32            `json:"numfiles"`
 	Cno       pgtype.Int4      `json:"cno"`
 	Timestamp pgtype.Timestamp `json:"timestamp"`
+	Branchid  int32            `json:"branchid"`
+	Parentid  pgtype.Int4      `json:"parentid"`
 }
 
 type File struct {
-	Projectid   int32       `json:"projectid"`
-	Path        string      `json:"path"`
-	Locked      int32       `json:"locked"`
-	Lockownerid pgtype.Text `json:"lockownerid"`
+	Projectid   int32            `json:"projectid"`
+	Path        string           `json:"path"`
+	Locked      int32            `json:"locked"`
+	Lockownerid pgtype.Text      `json:"lockownerid"`
+	Revcounter  int32            `json:"revcounter"`
+	Lockedat    pgtype.Timestamp `json:"lockedat"`
+	Lockexpires pgtype.Timestamp `json:"lockexpires"`
 }
 
 type Filerevision struct {
@@ -50,6 +76,29 @@ type Filerevision struct {
 	Numchunks  int32       `json:"numchunks"`
 	Filesize   int32       `json:"filesize"`
 	Frno       pgtype.Int4 `json:"frno"`
+	Oldpath    pgtype.Text `json:"oldpath"`
+}
+
+type Invite struct {
+	Inviteid   int32            `json:"inviteid"`
+	Teamid     int32            `json:"teamid"`
+	Email      string           `json:"email"`
+	Level      int32            `json:"level"`
+	Tokenhash  string           `json:"tokenhash"`
+	Userid     string           `json:"userid"`
+	Timestamp  pgtype.Timestamp `json:"timestamp"`
+	Expires    pgtype.Timestamp `json:"expires"`
+	Acceptedby pgtype.Text      `json:"acceptedby"`
+	Acceptedat pgtype.Timestamp `json:"acceptedat"`
+	Revoked    bool             `json:"revoked"`
+}
+
+type Localuser struct {
+	Userid       string           `json:"userid"`
+	Email        string           `json:"email"`
+	Name         string           `json:"name"`
+	Passwordhash string           `json:"passwordhash"`
+	Timestamp    pgtype.Timestamp `json:"timestamp"`
 }
 
 type Permissiongroup struct {
@@ -70,15 +119,33 @@ type Pgmembership struct {
 }
 
 type Project struct {
-	Projectid int32  `json:"projectid"`
-	Title     string `json:"title"`
-	Teamid    int32  `json:"teamid"`
+	Projectid     int32  `json:"projectid"`
+	Title         string `json:"title"`
+	Teamid        int32  `json:"teamid"`
+	Commitcounter int32  `json:"commitcounter"`
+	Restricted    bool   `json:"restricted"`
+}
+
+type Tag struct {
+	Tagid     int32            `json:"tagid"`
+	Projectid int32            `json:"projectid"`
+	Name      string           `json:"name"`
+	Commitid  int32            `json:"commitid"`
+	Message   string           `json:"message"`
+	Userid    string           `json:"userid"`
+	Timestamp pgtype.Timestamp `json:"timestamp"`
 }
 
 type Team struct {
-	Teamid int32       `json:"teamid"`
-	Name   string      `json:"name"`
-	Planid pgtype.Int4 `json:"planid"`
+	Teamid      int32       `json:"teamid"`
+	Name        string      `json:"name"`
+	Planid      pgtype.Int4 `json:"planid"`
+	Locktimeout int32       `json:"locktimeout"`
+}
+
+type Teamblock struct {
+	Teamid    int32  `json:"teamid"`
+	Blockhash string `json:"blockhash"`
 }
 
 type Teampermission struct {
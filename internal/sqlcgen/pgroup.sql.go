@@ -37,31 +37,71 @@ func (q *Queries) CreatePermissionGroup(ctx context.Context, arg CreatePermissio
 	return err
 }
 
-const deletePermissionGroup = `-- name: DeletePermissionGroup :exec
+const deletePermissionGroup = `-- name: DeletePermissionGroup :one
 DELETE FROM permissiongroup WHERE pgroupid = $1
+RETURNING name
 `
 
-func (q *Queries) DeletePermissionGroup(ctx context.Context, pgroupid int32) error {
-	_, err := q.db.Exec(ctx, deletePermissionGroup, pgroupid)
-	return err
+func (q *Queries) DeletePermissionGroup(ctx context.Context, pgroupid int32) (string, error) {
+	row := q.db.QueryRow(ctx, deletePermissionGroup, pgroupid)
+	var name string
+	err := row.Scan(&name)
+	return name, err
 }
 
-const dropPermissionGroupMapping = `-- name: DropPermissionGroupMapping :exec
+const dropPermissionGroupMapping = `-- name: DropPermissionGroupMapping :many
 DELETE FROM pgmapping WHERE pgroupid = $1
+RETURNING projectid, level
 `
 
-func (q *Queries) DropPermissionGroupMapping(ctx context.Context, pgroupid int32) error {
-	_, err := q.db.Exec(ctx, dropPermissionGroupMapping, pgroupid)
-	return err
+type DropPermissionGroupMappingRow struct {
+	Projectid int32 `json:"projectid"`
+	Level     int32 `json:"level"`
+}
+
+func (q *Queries) DropPermissionGroupMapping(ctx context.Context, pgroupid int32) ([]DropPermissionGroupMappingRow, error) {
+	rows, err := q.db.Query(ctx, dropPermissionGroupMapping, pgroupid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DropPermissionGroupMappingRow
+	for rows.Next() {
+		var i DropPermissionGroupMappingRow
+		if err := rows.Scan(&i.Projectid, &i.Level); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const dropPermissionGroupMembership = `-- name: DropPermissionGroupMembership :exec
+const dropPermissionGroupMembership = `-- name: DropPermissionGroupMembership :many
 DELETE FROM pgmembership WHERE pgroupid = $1
+RETURNING userid
 `
 
-func (q *Queries) DropPermissionGroupMembership(ctx context.Context, pgroupid int32) error {
-	_, err := q.db.Exec(ctx, dropPermissionGroupMembership, pgroupid)
-	return err
+func (q *Queries) DropPermissionGroupMembership(ctx context.Context, pgroupid int32) ([]string, error) {
+	rows, err := q.db.Query(ctx, dropPermissionGroupMembership, pgroupid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var userid string
+		if err := rows.Scan(&userid); err != nil {
+			return nil, err
+		}
+		items = append(items, userid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const findUserInPermissionGroup = `-- name: FindUserInPermissionGroup :many
@@ -90,13 +130,14 @@ func (q *Queries) FindUserInPermissionGroup(ctx context.Context, userid string)
 }
 
 const getPermissionGroupMapping = `-- name: GetPermissionGroupMapping :many
-SELECT p.projectid, p.title FROM pgmapping pg, project p
+SELECT p.projectid, p.title, pg.level FROM pgmapping pg, project p
 WHERE pg.pgroupid = $1 AND pg.projectid = p.projectid
 `
 
 type GetPermissionGroupMappingRow struct {
 	Projectid int32  `json:"projectid"`
 	Title     string `json:"title"`
+	Level     int32  `json:"level"`
 }
 
 func (q *Queries) GetPermissionGroupMapping(ctx context.Context, pgroupid int32) ([]GetPermissionGroupMappingRow, error) {
@@ -108,7 +149,7 @@ func (q *Queries) GetPermissionGroupMapping(ctx context.Context, pgroupid int32)
 	var items []GetPermissionGroupMappingRow
 	for rows.Next() {
 		var i GetPermissionGroupMappingRow
-		if err := rows.Scan(&i.Projectid, &i.Title); err != nil {
+		if err := rows.Scan(&i.Projectid, &i.Title, &i.Level); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -156,6 +197,26 @@ func (q *Queries) GetPermissionGroupsForUser(ctx context.Context, arg GetPermiss
 	return items, nil
 }
 
+const getProjectGroupLevel = `-- name: GetProjectGroupLevel :one
+SELECT COALESCE(MAX(pgma.level), -1)::integer AS level FROM pgmembership pgme
+INNER JOIN pgmapping pgma ON pgma.pgroupid = pgme.pgroupid
+WHERE pgme.userid = $1 AND pgma.projectid = $2
+`
+
+type GetProjectGroupLevelParams struct {
+	Userid    string `json:"userid"`
+	Projectid int32  `json:"projectid"`
+}
+
+// highest level the user gets on the project from their permission groups,
+// -1 if none of their groups are mapped to it
+func (q *Queries) GetProjectGroupLevel(ctx context.Context, arg GetProjectGroupLevelParams) (int32, error) {
+	row := q.db.QueryRow(ctx, getProjectGroupLevel, arg.Userid, arg.Projectid)
+	var level int32
+	err := row.Scan(&level)
+	return level, err
+}
+
 const getTeamFromPGroup = `-- name: GetTeamFromPGroup :one
 SELECT teamid FROM permissiongroup WHERE
 pgroupid = $1 LIMIT 1
@@ -242,16 +303,19 @@ func (q *Queries) ListPermissionGroupMembership(ctx context.Context, pgroupid in
 }
 
 const mapProjectToPermissionGroup = `-- name: MapProjectToPermissionGroup :exec
-INSERT INTO pgmapping(pgroupid, projectid) VALUES($1, $2)
+INSERT INTO pgmapping(pgroupid, projectid, level) VALUES($1, $2, $3)
+ON CONFLICT(pgroupid, projectid) DO UPDATE SET level = excluded.level
 `
 
 type MapProjectToPermissionGroupParams struct {
 	Pgroupid  int32 `json:"pgroupid"`
 	Projectid int32 `json:"projectid"`
+	Level     int32 `json:"level"`
 }
 
+// mapping a group that's already mapped changes its level
 func (q *Queries) MapProjectToPermissionGroup(ctx context.Context, arg MapProjectToPermissionGroupParams) error {
-	_, err := q.db.Exec(ctx, mapProjectToPermissionGroup, arg.Pgroupid, arg.Projectid)
+	_, err := q.db.Exec(ctx, mapProjectToPermissionGroup, arg.Pgroupid, arg.Projectid, arg.Level)
 	return err
 }
 
@@ -269,8 +333,41 @@ func (q *Queries) RemoveMemberFromPermissionGroup(ctx context.Context, arg Remov
 	return err
 }
 
-const removeProjectFromPermissionGroup = `-- name: RemoveProjectFromPermissionGroup :exec
+const removeMemberFromTeamPermissionGroups = `-- name: RemoveMemberFromTeamPermissionGroups :many
+DELETE FROM pgmembership WHERE userid = $1
+AND pgroupid IN (SELECT pgroupid FROM permissiongroup WHERE teamid = $2)
+RETURNING pgroupid
+`
+
+type RemoveMemberFromTeamPermissionGroupsParams struct {
+	Userid string `json:"userid"`
+	Teamid int32  `json:"teamid"`
+}
+
+// removes the user from every permission group in the team
+func (q *Queries) RemoveMemberFromTeamPermissionGroups(ctx context.Context, arg RemoveMemberFromTeamPermissionGroupsParams) ([]int32, error) {
+	rows, err := q.db.Query(ctx, removeMemberFromTeamPermissionGroups, arg.Userid, arg.Teamid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var pgroupid int32
+		if err := rows.Scan(&pgroupid); err != nil {
+			return nil, err
+		}
+		items = append(items, pgroupid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const removeProjectFromPermissionGroup = `-- name: RemoveProjectFromPermissionGroup :one
 DELETE FROM pgmapping WHERE pgroupid = $1 AND projectid = $2
+RETURNING level
 `
 
 type RemoveProjectFromPermissionGroupParams struct {
@@ -278,7 +375,9 @@ type RemoveProjectFromPermissionGroupParams struct {
 	Projectid int32 `json:"projectid"`
 }
 
-func (q *Queries) RemoveProjectFromPermissionGroup(ctx context.Context, arg RemoveProjectFromPermissionGroupParams) error {
-	_, err := q.db.Exec(ctx, removeProjectFromPermissionGroup, arg.Pgroupid, arg.Projectid)
-	return err
+func (q *Queries) RemoveProjectFromPermissionGroup(ctx context.Context, arg RemoveProjectFromPermissionGroupParams) (int32, error) {
+	row := q.db.QueryRow(ctx, removeProjectFromPermissionGroup, arg.Pgroupid, arg.Projectid)
+	var level int32
+	err := row.Scan(&level)
+	return level, err
 }
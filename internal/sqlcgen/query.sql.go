@@ -28,6 +28,40 @@ func (q *Queries) CheckProjectName(ctx context.Context, arg CheckProjectNamePara
 	return count, err
 }
 
+const countFileRevisions = `-- name: CountFileRevisions :one
+WITH RECURSIVE lineage(path, lowerfrid, upperfrid) AS (
+    SELECT $1::text, COALESCE((
+        SELECT MAX(frid) FROM filerevision WHERE projectid = $2::integer AND path = $1::text AND changetype = 4
+        AND commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), 2147483647
+    UNION ALL
+    SELECT renamed.oldpath, COALESCE((
+        SELECT MAX(prev.frid) FROM filerevision prev
+        WHERE prev.projectid = renamed.projectid AND prev.path = renamed.oldpath AND prev.changetype = 4 AND prev.frid < renamed.frid
+        AND prev.commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), renamed.frid
+    FROM lineage INNER JOIN filerevision renamed ON renamed.frid = lineage.lowerfrid
+    WHERE renamed.oldpath IS NOT NULL
+)
+SELECT COUNT(*) FROM filerevision
+INNER JOIN lineage ON filerevision.path = lineage.path AND filerevision.frid >= lineage.lowerfrid AND filerevision.frid < lineage.upperfrid
+INNER JOIN commit ON commit.commitid = filerevision.commitid
+WHERE filerevision.projectid = $2::integer AND commit.branchid = 0
+`
+
+type CountFileRevisionsParams struct {
+	Path      string `json:"path"`
+	Projectid int32  `json:"projectid"`
+}
+
+// same lineage as ListFileHistory
+func (q *Queries) CountFileRevisions(ctx context.Context, arg CountFileRevisionsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countFileRevisions, arg.Path, arg.Projectid)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countFilesUpdatedSinceCommit = `-- name: CountFilesUpdatedSinceCommit :one
 SELECT COUNT(distinct path) FROM filerevision WHERE
 commitid > $1 AND projectid = $2
@@ -47,12 +81,17 @@ func (q *Queries) CountFilesUpdatedSinceCommit(ctx context.Context, arg CountFil
 
 const countProjectCommits = `-- name: CountProjectCommits :one
 SELECT COUNT(commitid) FROM commit
-WHERE projectid = $1
+WHERE projectid = $1 AND branchid = $2
 LIMIT 1
 `
 
-func (q *Queries) CountProjectCommits(ctx context.Context, projectid int32) (int64, error) {
-	row := q.db.QueryRow(ctx, countProjectCommits, projectid)
+type CountProjectCommitsParams struct {
+	Projectid int32 `json:"projectid"`
+	Branchid  int32 `json:"branchid"`
+}
+
+func (q *Queries) CountProjectCommits(ctx context.Context, arg CountProjectCommitsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countProjectCommits, arg.Projectid, arg.Branchid)
 	var count int64
 	err := row.Scan(&count)
 	return count, err
@@ -60,17 +99,61 @@ func (q *Queries) CountProjectCommits(ctx context.Context, projectid int32) (int
 
 const deleteTeamPermission = `-- name: DeleteTeamPermission :one
 DELETE FROM teampermission
-WHERE userid = $1
+WHERE userid = $1 AND teamid = $2
 RETURNING userid, teamid, level
 `
 
-func (q *Queries) DeleteTeamPermission(ctx context.Context, userid string) (Teampermission, error) {
-	row := q.db.QueryRow(ctx, deleteTeamPermission, userid)
+type DeleteTeamPermissionParams struct {
+	Userid string `json:"userid"`
+	Teamid int32  `json:"teamid"`
+}
+
+func (q *Queries) DeleteTeamPermission(ctx context.Context, arg DeleteTeamPermissionParams) (Teampermission, error) {
+	row := q.db.QueryRow(ctx, deleteTeamPermission, arg.Userid, arg.Teamid)
 	var i Teampermission
 	err := row.Scan(&i.Userid, &i.Teamid, &i.Level)
 	return i, err
 }
 
+const findConflictingPaths = `-- name: FindConflictingPaths :many
+SELECT DISTINCT path FROM filerevision
+WHERE projectid = $1 AND commitid > $2 AND path = ANY($3::text[])
+AND commitid IN ( SELECT commitid FROM commit_ancestry($1, $4) )
+`
+
+type FindConflictingPathsParams struct {
+	Projectid    int32    `json:"projectid"`
+	ParentCommit int32    `json:"parent_commit"`
+	Paths        []string `json:"paths"`
+	HeadCommit   int32    `json:"head_commit"`
+}
+
+// paths changed after the parent commit on the way to head_commit
+func (q *Queries) FindConflictingPaths(ctx context.Context, arg FindConflictingPathsParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, findConflictingPaths,
+		arg.Projectid,
+		arg.ParentCommit,
+		arg.Paths,
+		arg.HeadCommit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		items = append(items, path)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const findProjectInitCommit = `-- name: FindProjectInitCommit :one
 SELECT commitid FROM commit
 WHERE projectid = $1
@@ -225,7 +308,8 @@ SELECT
   timestamp,
   comment,
   numfiles,
-  projectid
+  projectid,
+  branchid
 FROM commit
 WHERE
   commitid = $1 LIMIT 1
@@ -238,6 +322,7 @@ type GetCommitInfoRow struct {
 	Comment   string           `json:"comment"`
 	Numfiles  int32            `json:"numfiles"`
 	Projectid int32            `json:"projectid"`
+	Branchid  int32            `json:"branchid"`
 }
 
 func (q *Queries) GetCommitInfo(ctx context.Context, commitid int32) (GetCommitInfoRow, error) {
@@ -250,6 +335,7 @@ func (q *Queries) GetCommitInfo(ctx context.Context, commitid int32) (GetCommitI
 		&i.Comment,
 		&i.Numfiles,
 		&i.Projectid,
+		&i.Branchid,
 	)
 	return i, err
 }
@@ -272,6 +358,96 @@ func (q *Queries) GetFileHash(ctx context.Context, arg GetFileHashParams) (strin
 	return filehash, err
 }
 
+const getFileRevisionAtCommit = `-- name: GetFileRevisionAtCommit :one
+SELECT path, filehash, changetype, numchunks, filesize, oldpath FROM filerevision
+WHERE projectid = $1 AND path = $2 AND commitid IN ( SELECT commitid FROM commit_ancestry($1, $3) )
+ORDER BY frid DESC
+LIMIT 1
+`
+
+type GetFileRevisionAtCommitParams struct {
+	Projectid int32  `json:"projectid"`
+	Path      string `json:"path"`
+	Commitid  int32  `json:"commitid"`
+}
+
+type GetFileRevisionAtCommitRow struct {
+	Path       string      `json:"path"`
+	Filehash   string      `json:"filehash"`
+	Changetype int32       `json:"changetype"`
+	Numchunks  int32       `json:"numchunks"`
+	Filesize   int32       `json:"filesize"`
+	Oldpath    pgtype.Text `json:"oldpath"`
+}
+
+// latest revision of a path as of a commit
+func (q *Queries) GetFileRevisionAtCommit(ctx context.Context, arg GetFileRevisionAtCommitParams) (GetFileRevisionAtCommitRow, error) {
+	row := q.db.QueryRow(ctx, getFileRevisionAtCommit, arg.Projectid, arg.Path, arg.Commitid)
+	var i GetFileRevisionAtCommitRow
+	err := row.Scan(
+		&i.Path,
+		&i.Filehash,
+		&i.Changetype,
+		&i.Numchunks,
+		&i.Filesize,
+		&i.Oldpath,
+	)
+	return i, err
+}
+
+const getFileRevisionByNumber = `-- name: GetFileRevisionByNumber :one
+WITH RECURSIVE lineage(path, lowerfrid, upperfrid) AS (
+    SELECT $1::text, COALESCE((
+        SELECT MAX(frid) FROM filerevision WHERE projectid = $2::integer AND path = $1::text AND changetype = 4
+        AND commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), 2147483647
+    UNION ALL
+    SELECT renamed.oldpath, COALESCE((
+        SELECT MAX(prev.frid) FROM filerevision prev
+        WHERE prev.projectid = renamed.projectid AND prev.path = renamed.oldpath AND prev.changetype = 4 AND prev.frid < renamed.frid
+        AND prev.commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), renamed.frid
+    FROM lineage INNER JOIN filerevision renamed ON renamed.frid = lineage.lowerfrid
+    WHERE renamed.oldpath IS NOT NULL
+)
+SELECT filerevision.path, filerevision.filehash, filerevision.changetype, filerevision.numchunks, filerevision.filesize, filerevision.oldpath FROM filerevision
+INNER JOIN lineage ON filerevision.path = lineage.path AND filerevision.frid >= lineage.lowerfrid AND filerevision.frid < lineage.upperfrid
+INNER JOIN commit ON commit.commitid = filerevision.commitid
+WHERE filerevision.projectid = $2::integer AND commit.branchid = 0 AND filerevision.frno = $3
+ORDER BY filerevision.frid DESC
+LIMIT 1
+`
+
+type GetFileRevisionByNumberParams struct {
+	Path      string      `json:"path"`
+	Projectid int32       `json:"projectid"`
+	Frno      pgtype.Int4 `json:"frno"`
+}
+
+type GetFileRevisionByNumberRow struct {
+	Path       string      `json:"path"`
+	Filehash   string      `json:"filehash"`
+	Changetype int32       `json:"changetype"`
+	Numchunks  int32       `json:"numchunks"`
+	Filesize   int32       `json:"filesize"`
+	Oldpath    pgtype.Text `json:"oldpath"`
+}
+
+// a revision of a file on main by its number, on the same lineage as ListFileHistory
+func (q *Queries) GetFileRevisionByNumber(ctx context.Context, arg GetFileRevisionByNumberParams) (GetFileRevisionByNumberRow, error) {
+	row := q.db.QueryRow(ctx, getFileRevisionByNumber, arg.Path, arg.Projectid, arg.Frno)
+	var i GetFileRevisionByNumberRow
+	err := row.Scan(
+		&i.Path,
+		&i.Filehash,
+		&i.Changetype,
+		&i.Numchunks,
+		&i.Filesize,
+		&i.Oldpath,
+	)
+	return i, err
+}
+
 const getFileRevisionsByCommitId = `-- name: GetFileRevisionsByCommitId :many
 SELECT frid as filerevision_id, path, frno as filerevision_number, changetype, filesize, commitid as commit_id, projectid as project_id
 FROM filerevision
@@ -318,9 +494,10 @@ func (q *Queries) GetFileRevisionsByCommitId(ctx context.Context, commitid int32
 
 const getLatestCommit = `-- name: GetLatestCommit :one
 SELECT CAST(MAX(commitid) AS INTEGER) FROM commit
-WHERE projectid = $1
+WHERE projectid = $1 AND branchid = 0
 `
 
+// head of main
 func (q *Queries) GetLatestCommit(ctx context.Context, projectid int32) (int32, error) {
 	row := q.db.QueryRow(ctx, getLatestCommit, projectid)
 	var column_1 int32
@@ -328,35 +505,88 @@ func (q *Queries) GetLatestCommit(ctx context.Context, projectid int32) (int32,
 	return column_1, err
 }
 
-const getProjectDiffBetweenCommits = `-- name: GetProjectDiffBetweenCommits :many
-SELECT a.frid, a.path, a.commitid, a.filehash, a.changetype, a.filesize as blocksize FROM filerevision a
-INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision GROUP BY path ) b
+const getLatestRevisionsAtCommit = `-- name: GetLatestRevisionsAtCommit :many
+SELECT a.path, a.filehash, a.changetype, a.numchunks, a.filesize, a.oldpath FROM filerevision a
+INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = $1
+    AND filerevision.commitid IN ( SELECT commitid FROM commit_ancestry($1, $2) ) GROUP BY path ) b
 ON a.path = b.path AND a.frid = b.frid
-WHERE a.projectid = $1 AND a.commitid <= $2
-INTERSECT
-SELECT a.frid, a.path, a.commitid, a.filehash, a.changetype, a.filesize as blocksize FROM filerevision a
-INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision GROUP BY path ) b
+WHERE a.projectid = $1
+`
+
+type GetLatestRevisionsAtCommitParams struct {
+	Projectid int32 `json:"projectid"`
+	Commitid  int32 `json:"commitid"`
+}
+
+type GetLatestRevisionsAtCommitRow struct {
+	Path       string      `json:"path"`
+	Filehash   string      `json:"filehash"`
+	Changetype int32       `json:"changetype"`
+	Numchunks  int32       `json:"numchunks"`
+	Filesize   int32       `json:"filesize"`
+	Oldpath    pgtype.Text `json:"oldpath"`
+}
+
+// latest revision of every path in the project as of a commit, including deleted paths
+func (q *Queries) GetLatestRevisionsAtCommit(ctx context.Context, arg GetLatestRevisionsAtCommitParams) ([]GetLatestRevisionsAtCommitRow, error) {
+	rows, err := q.db.Query(ctx, getLatestRevisionsAtCommit, arg.Projectid, arg.Commitid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetLatestRevisionsAtCommitRow
+	for rows.Next() {
+		var i GetLatestRevisionsAtCommitRow
+		if err := rows.Scan(
+			&i.Path,
+			&i.Filehash,
+			&i.Changetype,
+			&i.Numchunks,
+			&i.Filesize,
+			&i.Oldpath,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getProjectDiffBetweenCommits = `-- name: GetProjectDiffBetweenCommits :many
+SELECT a.frid, a.path, a.commitid, a.filehash, a.changetype, a.filesize as blocksize, a.oldpath FROM filerevision a
+INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = $1
+    AND filerevision.commitid IN ( SELECT commitid FROM commit_ancestry($1, $2) ) GROUP BY path ) b
 ON a.path = b.path AND a.frid = b.frid
-WHERE a.projectid = $1 AND a.commitid <= $3
+WHERE a.projectid = $1 AND a.path IN (
+    SELECT path FROM filerevision WHERE filerevision.projectid = $1
+    AND (filerevision.commitid IN ( SELECT commitid FROM commit_ancestry($1, $2) ))
+    <> (filerevision.commitid IN ( SELECT commitid FROM commit_ancestry($1, $3) ))
+)
 `
 
 type GetProjectDiffBetweenCommitsParams struct {
 	Projectid  int32 `json:"projectid"`
-	Commitid   int32 `json:"commitid"`
-	Commitid_2 int32 `json:"commitid_2"`
+	ToCommit   int32 `json:"to_commit"`
+	FromCommit int32 `json:"from_commit"`
 }
 
 type GetProjectDiffBetweenCommitsRow struct {
-	Frid       int32  `json:"frid"`
-	Path       string `json:"path"`
-	Commitid   int32  `json:"commitid"`
-	Filehash   string `json:"filehash"`
-	Changetype int32  `json:"changetype"`
-	Blocksize  int32  `json:"blocksize"`
+	Frid       int32       `json:"frid"`
+	Path       string      `json:"path"`
+	Commitid   int32       `json:"commitid"`
+	Filehash   string      `json:"filehash"`
+	Changetype int32       `json:"changetype"`
+	Blocksize  int32       `json:"blocksize"`
+	Oldpath    pgtype.Text `json:"oldpath"`
 }
 
+// latest revision as of to_commit for every path that was changed after from_commit.
+// from_commit has to be on to_commit's lineage, paths only from_commit's side has aren't returned
 func (q *Queries) GetProjectDiffBetweenCommits(ctx context.Context, arg GetProjectDiffBetweenCommitsParams) ([]GetProjectDiffBetweenCommitsRow, error) {
-	rows, err := q.db.Query(ctx, getProjectDiffBetweenCommits, arg.Projectid, arg.Commitid, arg.Commitid_2)
+	rows, err := q.db.Query(ctx, getProjectDiffBetweenCommits, arg.Projectid, arg.ToCommit, arg.FromCommit)
 	if err != nil {
 		return nil, err
 	}
@@ -371,6 +601,7 @@ func (q *Queries) GetProjectDiffBetweenCommits(ctx context.Context, arg GetProje
 			&i.Filehash,
 			&i.Changetype,
 			&i.Blocksize,
+			&i.Oldpath,
 		); err != nil {
 			return nil, err
 		}
@@ -428,7 +659,8 @@ func (q *Queries) GetProjectLivingFiles(ctx context.Context, projectid int32) ([
 
 const getProjectState = `-- name: GetProjectState :many
 SELECT a.frid, a.path, a.commitid, a.filehash, a.changetype, a.filesize as blocksize FROM filerevision a
-INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = $1 GROUP BY path ) b
+INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = $1
+    AND filerevision.commitid IN ( SELECT commitid FROM commit WHERE commit.projectid = $1 AND commit.branchid = 0 ) GROUP BY path ) b
 ON a.path = b.path AND a.frid = b.frid
 WHERE a.projectid = $1
 `
@@ -471,9 +703,10 @@ func (q *Queries) GetProjectState(ctx context.Context, projectid int32) ([]GetPr
 
 const getProjectStateAtCommit = `-- name: GetProjectStateAtCommit :many
 SELECT a.frid, a.path, a.commitid, a.filehash, a.changetype, a.filesize as blocksize FROM filerevision a
-INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.commitid <= $2 AND filerevision.projectid = $1 GROUP BY path  ) b
+INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = $1
+    AND filerevision.commitid IN ( SELECT commitid FROM commit_ancestry($1, $2) ) GROUP BY path ) b
 ON a.path = b.path AND a.frid = b.frid
-WHERE a.projectid = $1 AND a.commitid <= $2
+WHERE a.projectid = $1
 `
 
 type GetProjectStateAtCommitParams struct {
@@ -614,6 +847,25 @@ func (q *Queries) GetTeamPermission(ctx context.Context, arg GetTeamPermissionPa
 	return level, err
 }
 
+const getTeamPermissionForUpdate = `-- name: GetTeamPermissionForUpdate :one
+SELECT level FROM teampermission
+WHERE teamid = $1 AND userid = $2
+FOR UPDATE
+`
+
+type GetTeamPermissionForUpdateParams struct {
+	Teamid int32  `json:"teamid"`
+	Userid string `json:"userid"`
+}
+
+// locks the user's row so the team's owner can't change underneath us
+func (q *Queries) GetTeamPermissionForUpdate(ctx context.Context, arg GetTeamPermissionForUpdateParams) (int32, error) {
+	row := q.db.QueryRow(ctx, getTeamPermissionForUpdate, arg.Teamid, arg.Userid)
+	var level int32
+	err := row.Scan(&level)
+	return level, err
+}
+
 const getUploadPermission = `-- name: GetUploadPermission :one
 SELECT COUNT(*) FROM teampermission
 WHERE userid = $1 LIMIT 1
@@ -627,8 +879,8 @@ func (q *Queries) GetUploadPermission(ctx context.Context, userid string) (int64
 }
 
 const insertCommit = `-- name: InsertCommit :one
-INSERT INTO commit(projectid, userid, comment, numfiles)
-VALUES ($1, $2, $3, $4)
+INSERT INTO commit(projectid, userid, comment, numfiles, branchid)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING commitid
 `
 
@@ -637,6 +889,7 @@ type InsertCommitParams struct {
 	Userid    string `json:"userid"`
 	Comment   string `json:"comment"`
 	Numfiles  int32  `json:"numfiles"`
+	Branchid  int32  `json:"branchid"`
 }
 
 func (q *Queries) InsertCommit(ctx context.Context, arg InsertCommitParams) (int32, error) {
@@ -645,6 +898,7 @@ func (q *Queries) InsertCommit(ctx context.Context, arg InsertCommitParams) (int
 		arg.Userid,
 		arg.Comment,
 		arg.Numfiles,
+		arg.Branchid,
 	)
 	var commitid int32
 	err := row.Scan(&commitid)
@@ -710,6 +964,32 @@ func (q *Queries) InsertProject(ctx context.Context, arg InsertProjectParams) (i
 	return projectid, err
 }
 
+const insertRenameRevision = `-- name: InsertRenameRevision :exec
+INSERT INTO filerevision(projectid, path, commitid, filehash, numchunks, changetype, oldpath)
+VALUES ($1, $2, $3, $4, $5, 4, $6::text)
+`
+
+type InsertRenameRevisionParams struct {
+	Projectid int32  `json:"projectid"`
+	Path      string `json:"path"`
+	Commitid  int32  `json:"commitid"`
+	Filehash  string `json:"filehash"`
+	Numchunks int32  `json:"numchunks"`
+	Oldpath   string `json:"oldpath"`
+}
+
+func (q *Queries) InsertRenameRevision(ctx context.Context, arg InsertRenameRevisionParams) error {
+	_, err := q.db.Exec(ctx, insertRenameRevision,
+		arg.Projectid,
+		arg.Path,
+		arg.Commitid,
+		arg.Filehash,
+		arg.Numchunks,
+		arg.Oldpath,
+	)
+	return err
+}
+
 const insertTeam = `-- name: InsertTeam :one
 INSERT INTO team(name)
 VALUES ($1)
@@ -761,9 +1041,124 @@ func (q *Queries) InsertTwoFileRevisions(ctx context.Context, arg InsertTwoFileR
 	return err
 }
 
+const isAncestorCommit = `-- name: IsAncestorCommit :one
+SELECT EXISTS ( SELECT 1 FROM commit_ancestry($1, $2) ancestry WHERE ancestry.commitid = $3 )::boolean
+`
+
+type IsAncestorCommitParams struct {
+	Projectid  int32 `json:"projectid"`
+	HeadCommit int32 `json:"head_commit"`
+	Commitid   int32 `json:"commitid"`
+}
+
+// whether commitid is head_commit or comes before it
+func (q *Queries) IsAncestorCommit(ctx context.Context, arg IsAncestorCommitParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isAncestorCommit, arg.Projectid, arg.HeadCommit, arg.Commitid)
+	var column_1 bool
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const isProjectRestricted = `-- name: IsProjectRestricted :one
+SELECT restricted FROM project
+WHERE projectid = $1 LIMIT 1
+`
+
+func (q *Queries) IsProjectRestricted(ctx context.Context, projectid int32) (bool, error) {
+	row := q.db.QueryRow(ctx, isProjectRestricted, projectid)
+	var restricted bool
+	err := row.Scan(&restricted)
+	return restricted, err
+}
+
+const listFileHistory = `-- name: ListFileHistory :many
+WITH RECURSIVE lineage(path, lowerfrid, upperfrid) AS (
+    SELECT $1::text, COALESCE((
+        SELECT MAX(frid) FROM filerevision WHERE projectid = $2::integer AND path = $1::text AND changetype = 4
+        AND commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), 2147483647
+    UNION ALL
+    SELECT renamed.oldpath, COALESCE((
+        SELECT MAX(prev.frid) FROM filerevision prev
+        WHERE prev.projectid = renamed.projectid AND prev.path = renamed.oldpath AND prev.changetype = 4 AND prev.frid < renamed.frid
+        AND prev.commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), renamed.frid
+    FROM lineage INNER JOIN filerevision renamed ON renamed.frid = lineage.lowerfrid
+    WHERE renamed.oldpath IS NOT NULL
+)
+SELECT filerevision.path, filerevision.oldpath, filerevision.frno, filerevision.filehash, filerevision.changetype, filerevision.filesize,
+commit.commitid, commit.cno, commit.userid, commit.comment, commit.timestamp
+FROM filerevision
+INNER JOIN lineage ON filerevision.path = lineage.path AND filerevision.frid >= lineage.lowerfrid AND filerevision.frid < lineage.upperfrid
+INNER JOIN commit ON commit.commitid = filerevision.commitid
+WHERE filerevision.projectid = $2::integer AND commit.branchid = 0
+ORDER BY filerevision.frid DESC
+LIMIT $3 OFFSET $4
+`
+
+type ListFileHistoryParams struct {
+	Path       string `json:"path"`
+	Projectid  int32  `json:"projectid"`
+	PageSize   int32  `json:"page_size"`
+	PageOffset int32  `json:"page_offset"`
+}
+
+type ListFileHistoryRow struct {
+	Path       string           `json:"path"`
+	Oldpath    pgtype.Text      `json:"oldpath"`
+	Frno       pgtype.Int4      `json:"frno"`
+	Filehash   string           `json:"filehash"`
+	Changetype int32            `json:"changetype"`
+	Filesize   int32            `json:"filesize"`
+	Commitid   int32            `json:"commitid"`
+	Cno        pgtype.Int4      `json:"cno"`
+	Userid     string           `json:"userid"`
+	Comment    string           `json:"comment"`
+	Timestamp  pgtype.Timestamp `json:"timestamp"`
+}
+
+// revisions of a file on main, following it back through renames:
+// each lineage row is a path and the frid range the file lived there
+func (q *Queries) ListFileHistory(ctx context.Context, arg ListFileHistoryParams) ([]ListFileHistoryRow, error) {
+	rows, err := q.db.Query(ctx, listFileHistory,
+		arg.Path,
+		arg.Projectid,
+		arg.PageSize,
+		arg.PageOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFileHistoryRow
+	for rows.Next() {
+		var i ListFileHistoryRow
+		if err := rows.Scan(
+			&i.Path,
+			&i.Oldpath,
+			&i.Frno,
+			&i.Filehash,
+			&i.Changetype,
+			&i.Filesize,
+			&i.Commitid,
+			&i.Cno,
+			&i.Userid,
+			&i.Comment,
+			&i.Timestamp,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listProjectCommits = `-- name: ListProjectCommits :many
 SELECT cno, numfiles, userid, comment, commitid, timestamp FROM commit
-WHERE projectid = $1
+WHERE projectid = $1 AND branchid = $4
 ORDER BY commitid DESC
 LIMIT $3 OFFSET $2
 `
@@ -772,6 +1167,7 @@ type ListProjectCommitsParams struct {
 	Projectid int32 `json:"projectid"`
 	Offset    int32 `json:"offset"`
 	Limit     int32 `json:"limit"`
+	Branchid  int32 `json:"branchid"`
 }
 
 type ListProjectCommitsRow struct {
@@ -784,7 +1180,12 @@ type ListProjectCommitsRow struct {
 }
 
 func (q *Queries) ListProjectCommits(ctx context.Context, arg ListProjectCommitsParams) ([]ListProjectCommitsRow, error) {
-	rows, err := q.db.Query(ctx, listProjectCommits, arg.Projectid, arg.Offset, arg.Limit)
+	rows, err := q.db.Query(ctx, listProjectCommits,
+		arg.Projectid,
+		arg.Offset,
+		arg.Limit,
+		arg.Branchid,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -810,19 +1211,42 @@ func (q *Queries) ListProjectCommits(ctx context.Context, arg ListProjectCommits
 	return items, nil
 }
 
-const restoreProjectToCommit = `-- name: RestoreProjectToCommit :exec
-SELECT commitid, projectid, userid, comment, numfiles, cno, timestamp FROM commit WHERE numfiles = $3 and projectid = $2 and commitid = $1
+const lockProjectForCommit = `-- name: LockProjectForCommit :exec
+SELECT projectid FROM project
+WHERE projectid = $1
+FOR UPDATE
 `
 
-type RestoreProjectToCommitParams struct {
-	Commitid  int32 `json:"commitid"`
-	Projectid int32 `json:"projectid"`
-	NewCommit int32 `json:"new_commit"`
+// serializes commits to a project until the transaction ends
+func (q *Queries) LockProjectForCommit(ctx context.Context, projectid int32) error {
+	_, err := q.db.Exec(ctx, lockProjectForCommit, projectid)
+	return err
+}
+
+const repairNumbering = `-- name: RepairNumbering :one
+SELECT repair_numbering()::integer AS renumbered
+`
+
+// renumbers duplicate commit/file revision numbers, returns how many rows changed
+func (q *Queries) RepairNumbering(ctx context.Context) (int32, error) {
+	row := q.db.QueryRow(ctx, repairNumbering)
+	var renumbered int32
+	err := row.Scan(&renumbered)
+	return renumbered, err
+}
+
+const setProjectRestricted = `-- name: SetProjectRestricted :exec
+UPDATE project SET restricted = $2
+WHERE projectid = $1
+`
+
+type SetProjectRestrictedParams struct {
+	Projectid  int32 `json:"projectid"`
+	Restricted bool  `json:"restricted"`
 }
 
-// TODO
-func (q *Queries) RestoreProjectToCommit(ctx context.Context, arg RestoreProjectToCommitParams) error {
-	_, err := q.db.Exec(ctx, restoreProjectToCommit, arg.Commitid, arg.Projectid, arg.NewCommit)
+func (q *Queries) SetProjectRestricted(ctx context.Context, arg SetProjectRestrictedParams) error {
+	_, err := q.db.Exec(ctx, setProjectRestricted, arg.Projectid, arg.Restricted)
 	return err
 }
 
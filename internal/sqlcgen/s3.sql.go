@@ -9,14 +9,70 @@ import (
 	"context"
 )
 
+const findExistingBlocks = `-- name: FindExistingBlocks :many
+SELECT blockhash FROM block
+WHERE blockhash = ANY($1::text[])
+`
+
+func (q *Queries) FindExistingBlocks(ctx context.Context, blockhashes []string) ([]string, error) {
+	rows, err := q.db.Query(ctx, findExistingBlocks, blockhashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var blockhash string
+		if err := rows.Scan(&blockhash); err != nil {
+			return nil, err
+		}
+		items = append(items, blockhash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findTeamBlocks = `-- name: FindTeamBlocks :many
+SELECT blockhash FROM teamblock
+WHERE teamid = $1 AND blockhash = ANY($2::text[])
+`
+
+type FindTeamBlocksParams struct {
+	Teamid      int32    `json:"teamid"`
+	Blockhashes []string `json:"blockhashes"`
+}
+
+func (q *Queries) FindTeamBlocks(ctx context.Context, arg FindTeamBlocksParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, findTeamBlocks, arg.Teamid, arg.Blockhashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var blockhash string
+		if err := rows.Scan(&blockhash); err != nil {
+			return nil, err
+		}
+		items = append(items, blockhash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getFileChunks = `-- name: GetFileChunks :many
-SELECT blockhash, chunkindex FROM chunk
+SELECT blockhash, chunkindex, blocksize FROM chunk
 WHERE filehash = $1 ORDER BY chunkindex ASC
 `
 
 type GetFileChunksRow struct {
 	Blockhash  string `json:"blockhash"`
 	Chunkindex int32  `json:"chunkindex"`
+	Blocksize  int32  `json:"blocksize"`
 }
 
 func (q *Queries) GetFileChunks(ctx context.Context, filehash string) ([]GetFileChunksRow, error) {
@@ -28,7 +84,7 @@ func (q *Queries) GetFileChunks(ctx context.Context, filehash string) ([]GetFile
 	var items []GetFileChunksRow
 	for rows.Next() {
 		var i GetFileChunksRow
-		if err := rows.Scan(&i.Blockhash, &i.Chunkindex); err != nil {
+		if err := rows.Scan(&i.Blockhash, &i.Chunkindex, &i.Blocksize); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -91,6 +147,90 @@ func (q *Queries) InsertHash(ctx context.Context, arg InsertHashParams) error {
 	return err
 }
 
+const insertTeamBlock = `-- name: InsertTeamBlock :exec
+INSERT INTO teamblock(teamid, blockhash) VALUES ($1, $2)
+ON CONFLICT(teamid, blockhash) DO NOTHING
+`
+
+type InsertTeamBlockParams struct {
+	Teamid    int32  `json:"teamid"`
+	Blockhash string `json:"blockhash"`
+}
+
+func (q *Queries) InsertTeamBlock(ctx context.Context, arg InsertTeamBlockParams) error {
+	_, err := q.db.Exec(ctx, insertTeamBlock, arg.Teamid, arg.Blockhash)
+	return err
+}
+
+const listFileChunkIndexes = `-- name: ListFileChunkIndexes :many
+SELECT chunk.filehash, chunk.chunkindex, chunk.numchunks FROM chunk
+INNER JOIN teamblock ON teamblock.blockhash = chunk.blockhash AND teamblock.teamid = $1
+WHERE chunk.filehash = ANY($2::text[])
+ORDER BY chunk.filehash, chunk.chunkindex ASC
+`
+
+type ListFileChunkIndexesParams struct {
+	Teamid     int32    `json:"teamid"`
+	Filehashes []string `json:"filehashes"`
+}
+
+type ListFileChunkIndexesRow struct {
+	Filehash   string `json:"filehash"`
+	Chunkindex int32  `json:"chunkindex"`
+	Numchunks  int32  `json:"numchunks"`
+}
+
+// only lists chunks whose block the team has
+func (q *Queries) ListFileChunkIndexes(ctx context.Context, arg ListFileChunkIndexesParams) ([]ListFileChunkIndexesRow, error) {
+	rows, err := q.db.Query(ctx, listFileChunkIndexes, arg.Teamid, arg.Filehashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFileChunkIndexesRow
+	for rows.Next() {
+		var i ListFileChunkIndexesRow
+		if err := rows.Scan(&i.Filehash, &i.Chunkindex, &i.Numchunks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const registerChunks = `-- name: RegisterChunks :execrows
+INSERT INTO chunk(chunkindex, numchunks, filehash, blockhash, blocksize)
+SELECT c.chunkindex, c.numchunks, c.filehash, b.blockhash, b.blocksize
+FROM unnest($1::int[], $2::int[], $3::text[], $4::text[])
+AS c(chunkindex, numchunks, filehash, blockhash)
+INNER JOIN block b ON b.blockhash = c.blockhash
+ON CONFLICT(filehash, chunkindex) DO NOTHING
+`
+
+type RegisterChunksParams struct {
+	Chunkindexes []int32  `json:"chunkindexes"`
+	Numchunks    []int32  `json:"numchunks"`
+	Filehashes   []string `json:"filehashes"`
+	Blockhashes  []string `json:"blockhashes"`
+}
+
+// only registers chunks whose block is already stored
+func (q *Queries) RegisterChunks(ctx context.Context, arg RegisterChunksParams) (int64, error) {
+	result, err := q.db.Exec(ctx, registerChunks,
+		arg.Chunkindexes,
+		arg.Numchunks,
+		arg.Filehashes,
+		arg.Blockhashes,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const removeHash = `-- name: RemoveHash :exec
 DELETE FROM block WHERE blockhash = $1
 `
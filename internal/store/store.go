@@ -1,7 +1,36 @@
 package store
 
-import "github.com/charmbracelet/log"
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
 
-func Hello() {
-	log.Info("hehe")
+// Blobs is the blob store used for block storage, set up in main
+var Blobs BlobStore
+
+var ErrNotFound = errors.New("blob not found")
+var ErrExists = errors.New("blob already exists")
+
+type BlobInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// BlobStore is where blocks live, keyed by their block hash
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+	// PresignGet returns a url that can fetch the blob without further auth
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// PresignPut returns a url the client can upload the blob to directly, along with
+	// headers the upload has to be sent with. the upload is refused if the key already exists
+	// so a finalized block can't be swapped out while the url is still valid
+	PresignPut(ctx context.Context, key string, expiry time.Duration) (string, http.Header, error)
+	List(ctx context.Context) ([]BlobInfo, error)
 }
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-chi/chi/v5"
+)
+
+// keys are block hashes, so anything else is rejected to keep
+// requests from escaping the storage directory
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LocalStore keeps blobs in a directory on disk and hands out
+// signed urls that point back at this server
+type LocalStore struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocalStore(dir string, baseURL string, secret string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, errors.New("local store needs a directory")
+	}
+	if secret == "" {
+		return nil, errors.New("local store needs a signing secret")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/"), secret: []byte(secret)}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if !validKey.MatchString(key) {
+		return "", errors.New("invalid key")
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	return s.write(key, r, size, true)
+}
+
+// writes the blob, if overwrite isn't set and the key exists already it returns ErrExists
+func (s *LocalStore) write(key string, r io.Reader, size int64, overwrite bool) error {
+	dst, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file first so readers never see a partial blob
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return errors.New("blob size does not match")
+	}
+	if overwrite {
+		return os.Rename(tmp.Name(), dst)
+	}
+	// unlike rename, link fails if dst exists so two uploads can't race past each other
+	err = os.Link(tmp.Name(), dst)
+	if errors.Is(err, os.ErrExist) {
+		return ErrExists
+	}
+	return err
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	info, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return BlobInfo{}, ErrNotFound
+	} else if err != nil {
+		return BlobInfo{}, err
+	}
+	return BlobInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStore) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return s.presign(http.MethodGet, key, expiry)
+}
+
+// RoutePutBlob refuses existing keys itself, so no extra headers are needed
+func (s *LocalStore) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, http.Header, error) {
+	url, err := s.presign(http.MethodPut, key, expiry)
+	return url, nil, err
+}
+
+func (s *LocalStore) List(ctx context.Context) ([]BlobInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var blobs []BlobInfo
+	for _, entry := range entries {
+		if entry.IsDir() || !validKey.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, BlobInfo{Key: entry.Name(), Size: info.Size(), LastModified: info.ModTime()})
+	}
+	return blobs, nil
+}
+
+func (s *LocalStore) presign(method string, key string, expiry time.Duration) (string, error) {
+	if !validKey.MatchString(key) {
+		return "", errors.New("invalid key")
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	params := url.Values{}
+	params.Set("expires", expires)
+	params.Set("signature", s.sign(method, key, expires))
+	return s.baseURL + "/store/local/" + key + "?" + params.Encode(), nil
+}
+
+func (s *LocalStore) sign(method string, key string, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(method + "\n" + key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checks the signature and expiry on a presigned request
+func (s *LocalStore) verify(r *http.Request, key string) bool {
+	expires := r.URL.Query().Get("expires")
+	signature := r.URL.Query().Get("signature")
+	if expires == "" || signature == "" {
+		return false
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	expected := s.sign(r.Method, key, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// RouteGetBlob serves blocks for urls handed out by PresignGet
+func (s *LocalStore) RouteGetBlob(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if !s.verify(r, key) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	blob, err := s.Get(r.Context(), key)
+	if err == ErrNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Error("couldn't read blob", "key", key, "err", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.Copy(w, blob)
+}
+
+// RoutePutBlob accepts uploads for urls handed out by PresignPut.
+// blobs that already exist are never overwritten, the client gets a 409 and can go on to finalize
+func (s *LocalStore) RoutePutBlob(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if !s.verify(r, key) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if _, err := s.Stat(r.Context(), key); err == nil {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	err := s.write(key, r.Body, r.ContentLength, false)
+	if errors.Is(err, ErrExists) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Error("couldn't write blob", "key", key, "err", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func newTestLocalStore(t *testing.T) *LocalStore {
+	t.Helper()
+	s, err := NewLocalStore(t.TempDir(), "http://localhost", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestLocalRouter(s *LocalStore) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/store/local/{key}", s.RouteGetBlob)
+	r.Put("/store/local/{key}", s.RoutePutBlob)
+	return r
+}
+
+func TestLocalStoreVerify(t *testing.T) {
+	s := newTestLocalStore(t)
+	presign := func(method string, key string, expiry time.Duration) string {
+		u, err := s.presign(method, key, expiry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	tamper := func(u string, name string, value string) string {
+		parsed, _ := url.Parse(u)
+		query := parsed.Query()
+		if value == "" {
+			query.Del(name)
+		} else {
+			query.Set(name, value)
+		}
+		parsed.RawQuery = query.Encode()
+		return parsed.String()
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		key    string
+		want   bool
+	}{
+		{"get", http.MethodGet, presign(http.MethodGet, "abc", time.Minute), "abc", true},
+		{"put", http.MethodPut, presign(http.MethodPut, "abc", time.Minute), "abc", true},
+		{"wrong method", http.MethodPut, presign(http.MethodGet, "abc", time.Minute), "abc", false},
+		{"wrong key", http.MethodGet, presign(http.MethodGet, "abc", time.Minute), "abd", false},
+		{"expired", http.MethodGet, presign(http.MethodGet, "abc", -time.Minute), "abc", false},
+		{"bad signature", http.MethodGet, tamper(presign(http.MethodGet, "abc", time.Minute), "signature", "00"), "abc", false},
+		{"no signature", http.MethodGet, tamper(presign(http.MethodGet, "abc", time.Minute), "signature", ""), "abc", false},
+		{"moved expiry", http.MethodGet, tamper(presign(http.MethodGet, "abc", time.Minute), "expires", "99999999999"), "abc", false},
+		{"bad expiry", http.MethodGet, tamper(presign(http.MethodGet, "abc", time.Minute), "expires", "soon"), "abc", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.url, nil)
+			if got := s.verify(r, test.key); got != test.want {
+				t.Errorf("verify() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLocalStorePresignInvalidKey(t *testing.T) {
+	s := newTestLocalStore(t)
+	for _, key := range []string{"", "../secret", "a/b", "a.b"} {
+		if _, _, err := s.PresignPut(context.Background(), key, time.Minute); err == nil {
+			t.Errorf("PresignPut(%q) should fail", key)
+		}
+	}
+}
+
+func TestRoutePutBlob(t *testing.T) {
+	s := newTestLocalStore(t)
+	router := newTestLocalRouter(s)
+	putURL, _, err := s.PresignPut(context.Background(), "abc", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getURL, err := s.PresignGet(context.Background(), "abc", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// steps run in order against the same store
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{"bad signature", http.MethodPut, strings.Replace(putURL, "signature=", "signature=00", 1), "first", http.StatusForbidden},
+		{"get before upload", http.MethodGet, getURL, "", http.StatusNotFound},
+		{"upload", http.MethodPut, putURL, "first", http.StatusOK},
+		{"upload again", http.MethodPut, putURL, "second", http.StatusConflict},
+		{"put with get url", http.MethodPut, getURL, "second", http.StatusForbidden},
+		{"get", http.MethodGet, getURL, "", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != test.want {
+				t.Errorf("status = %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+
+	// the second upload must not have replaced the first
+	blob, err := s.Get(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+	contents, _ := io.ReadAll(blob)
+	if string(contents) != "first" {
+		t.Errorf("blob = %q, want %q", contents, "first")
+	}
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Store(bucket string) (*S3Store, error) {
+	client, err := generateS3Client()
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{client: client, bucket: bucket}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size,
+		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	return err
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	// GetObject doesn't hit the network until the first read, so stat first
+	// to get a proper not found error
+	if _, err := s.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return BlobInfo{}, mapS3Error(err)
+	}
+	return BlobInfo{Key: info.Key, Size: info.Size, LastModified: info.LastModified}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Store) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	reqParams := make(url.Values)
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, reqParams)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// the url is signed with If-None-Match: * so S3 rejects the upload with a 412 if the key exists
+func (s *S3Store) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, http.Header, error) {
+	headers := make(http.Header)
+	headers.Set("If-None-Match", "*")
+	u, err := s.client.PresignHeader(ctx, http.MethodPut, s.bucket, key, expiry, nil, headers)
+	if err != nil {
+		return "", nil, err
+	}
+	return u.String(), headers, nil
+}
+
+func (s *S3Store) List(ctx context.Context) ([]BlobInfo, error) {
+	var blobs []BlobInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		blobs = append(blobs, BlobInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+	}
+	return blobs, nil
+}
+
+func mapS3Error(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
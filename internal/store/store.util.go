@@ -18,3 +18,16 @@ func generateS3Client() (*minio.Client, error) {
 		Secure: useSSL,
 	})
 }
+
+// NewFromEnv picks a blob store based on STORE_BACKEND, defaulting to s3
+func NewFromEnv() (BlobStore, error) {
+	switch os.Getenv("STORE_BACKEND") {
+	case "local":
+		return NewLocalStore(
+			os.Getenv("STORE_LOCAL_DIR"),
+			os.Getenv("STORE_PUBLIC_URL"),
+			os.Getenv("STORE_LOCAL_SECRET"))
+	default:
+		return NewS3Store(os.Getenv("S3_BUCKETNAME"))
+	}
+}
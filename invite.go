@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/notify"
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+)
+
+const defaultInviteDays = 7
+const maxInviteDays = 30
+
+type Invite struct {
+	Id        int    `json:"id"`
+	Email     string `json:"email"`
+	Level     int    `json:"level"`
+	InvitedBy string `json:"invited_by"`
+	Timestamp int64  `json:"timestamp"`
+	Expires   int64  `json:"expires"`
+}
+
+type CreateInviteRequest struct {
+	Email     string `json:"email"`
+	Level     int    `json:"level"`
+	ExpiresIn int    `json:"expires_in"` // days, 7 if not set
+}
+
+type CreateInviteOutput struct {
+	Id      int   `json:"id"`
+	Expires int64 `json:"expires"`
+}
+
+type RevokeInviteRequest struct {
+	Id int `json:"id"`
+}
+
+type AcceptInviteRequest struct {
+	Token string `json:"token"`
+}
+
+type AcceptInviteOutput struct {
+	TeamId int `json:"team_id"`
+	Level  int `json:"level"`
+}
+
+// invite tokens are stored as a hash so a database leak doesn't hand out team access
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func teamRoleName(level int) string {
+	switch level {
+	case TeamRoleMember:
+		return "Member"
+	case TeamRoleManager:
+		return "Manager"
+	case TeamRoleOwner:
+		return "Owner"
+	default:
+		return "Undefined"
+	}
+}
+
+// input: url param team-id, body {email, level, expires_in}
+// invites someone to the team whether or not they have an account yet,
+// the token goes out through the notifier and not in the response
+func CreateInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	teamId, err := strconv.Atoi(chi.URLParam(r, "team-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request CreateInviteRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+	address, err := mail.ParseAddress(request.Email)
+	if err != nil {
+		WriteCustomError(w, "invalid email")
+		return
+	}
+	email := strings.ToLower(address.Address)
+	if request.ExpiresIn == 0 {
+		request.ExpiresIn = defaultInviteDays
+	}
+	if request.ExpiresIn < 1 || request.ExpiresIn > maxInviteDays {
+		WriteCustomError(w, "invalid expiry")
+		return
+	}
+	// owners are made by transferring ownership
+	if request.Level != TeamRoleMember && request.Level != TeamRoleManager {
+		WriteCustomError(w, "invalid level")
+		return
+	}
+	if !CanSetterUpdateUser(CheckPermissionByID(teamId, userId), 0, request.Level) {
+		WriteError(w, insufficientPermission)
+		return
+	}
+	teamName, err := dal.Queries.GetTeamName(ctx, int32(teamId))
+	if err != nil {
+		WriteCustomError(w, "team not found")
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		log.Error("couldn't generate invite token", "err", err)
+		WriteCustomError(w, "generic error")
+		return
+	}
+	token := hex.EncodeToString(raw)
+
+	// only keep the invite if it could be delivered
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	invite, err := qtx.InsertInvite(ctx, sqlcgen.InsertInviteParams{
+		Teamid:    int32(teamId),
+		Email:     email,
+		Level:     int32(request.Level),
+		Tokenhash: hashInviteToken(token),
+		Userid:    userId,
+		Days:      int32(request.ExpiresIn),
+	})
+	if err != nil {
+		log.Error("couldn't create invite", "team", teamId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	err = notify.Sender.SendInvite(ctx, notify.Invite{
+		Email:     email,
+		TeamName:  teamName,
+		Role:      teamRoleName(request.Level),
+		Token:     token,
+		InvitedBy: userId,
+		Expires:   invite.Expires.Time,
+	})
+	if err != nil {
+		log.Error("couldn't send invite", "team", teamId, "email", email, "err", err)
+		WriteCustomError(w, "couldn't send invite")
+		return
+	}
+	tx.Commit(ctx)
+
+	log.Info("invited user to team", "team", teamId, "email", email, "level", request.Level, "by", userId)
+	output_bytes, _ := json.Marshal(CreateInviteOutput{
+		Id:      int(invite.Inviteid),
+		Expires: invite.Expires.Time.UnixNano() / 1000000000,
+	})
+	WriteSuccess(w, string(output_bytes))
+}
+
+// input: url param team-id
+// returns the team's invites that are still waiting to be accepted
+func GetTeamInvites(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	teamId, err := strconv.Atoi(chi.URLParam(r, "team-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	if CheckPermissionByID(teamId, claims.Subject) < TeamRoleManager {
+		WriteError(w, insufficientPermission)
+		return
+	}
+
+	rows, err := dal.Queries.ListPendingInvites(ctx, int32(teamId))
+	if err != nil {
+		log.Error("couldn't list invites", "team", teamId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	invites := make([]Invite, 0, len(rows))
+	for _, row := range rows {
+		invites = append(invites, Invite{
+			Id:        int(row.Inviteid),
+			Email:     row.Email,
+			Level:     int(row.Level),
+			InvitedBy: row.Userid,
+			Timestamp: row.Timestamp.Time.UnixNano() / 1000000000,
+			Expires:   row.Expires.Time.UnixNano() / 1000000000,
+		})
+	}
+	output_bytes, _ := json.Marshal(invites)
+	WriteSuccess(w, string(output_bytes))
+}
+
+// input: url param team-id, body {id}
+func RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	teamId, err := strconv.Atoi(chi.URLParam(r, "team-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request RevokeInviteRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+	if CheckPermissionByID(teamId, userId) < TeamRoleManager {
+		WriteError(w, insufficientPermission)
+		return
+	}
+
+	email, err := dal.Queries.RevokeInvite(ctx, sqlcgen.RevokeInviteParams{Inviteid: int32(request.Id), Teamid: int32(teamId)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		WriteCustomError(w, "invite not found")
+		return
+	} else if err != nil {
+		log.Error("couldn't revoke invite", "invite", request.Id, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	log.Info("revoked invite", "team", teamId, "email", email, "by", userId)
+	WriteDefaultSuccess(w, "invite revoked")
+}
+
+// input: body {token}
+// binds an invite to the signed in account, which is how someone invited before
+// they had an account joins the team after their first login. invites are never
+// applied automatically on sign in, the client has to call this with the token.
+// the account's email has to be the one the invite was sent to, so a forwarded or
+// leaked token is no use to anyone else.
+// accepting never lowers a level the user already has in the team
+func AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	var request AcceptInviteRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Token == "" {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	user, err := auth.Users.GetUser(ctx, userId)
+	if err != nil {
+		log.Error("couldn't get user", "user", userId, "err", err)
+		WriteCustomError(w, "generic error")
+		return
+	}
+	if user.Email == "" {
+		WriteCustomError(w, "invalid invite")
+		return
+	}
+
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	invite, err := qtx.AcceptInvite(ctx, sqlcgen.AcceptInviteParams{
+		Userid:    userId,
+		Tokenhash: hashInviteToken(request.Token),
+		Email:     user.Email,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// unknown, revoked, expired, already used, or sent to another email
+		WriteCustomError(w, "invalid invite")
+		return
+	} else if err != nil {
+		log.Error("couldn't accept invite", "user", userId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	level, err := qtx.GetTeamPermission(ctx, sqlcgen.GetTeamPermissionParams{Teamid: invite.Teamid, Userid: userId})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Error("couldn't get team permission", "team", invite.Teamid, "user", userId, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	if level < invite.Level {
+		level = invite.Level
+		_, err = qtx.SetTeamPermission(ctx, sqlcgen.SetTeamPermissionParams{Userid: userId, Teamid: invite.Teamid, Level: level})
+		if err != nil {
+			log.Error("couldn't set team permission", "team", invite.Teamid, "user", userId, "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+	}
+	tx.Commit(ctx)
+
+	log.Info("accepted invite", "team", invite.Teamid, "user", userId, "level", level)
+	output_bytes, _ := json.Marshal(AcceptInviteOutput{TeamId: int(invite.Teamid), Level: int(level)})
+	WriteSuccess(w, string(output_bytes))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
+)
+
+// fakeUsers is a UserDirectory backed by a map
+type fakeUsers map[string]auth.User
+
+func (f fakeUsers) GetUser(ctx context.Context, userId string) (auth.User, error) {
+	user, ok := f[userId]
+	if !ok {
+		return auth.User{}, auth.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (f fakeUsers) GetUsers(ctx context.Context, userIds []string) (map[string]auth.User, error) {
+	users := make(map[string]auth.User)
+	for _, id := range userIds {
+		if user, ok := f[id]; ok {
+			users[id] = user
+		}
+	}
+	return users, nil
+}
+
+func (f fakeUsers) FindUserByEmail(ctx context.Context, email string) (auth.User, error) {
+	for _, user := range f {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return auth.User{}, auth.ErrUserNotFound
+}
+
+func (f fakeUsers) ListUsers(ctx context.Context) ([]auth.User, error) {
+	users := make([]auth.User, 0, len(f))
+	for _, user := range f {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// only covers what AcceptInvite rejects before it gets to the database
+func TestAcceptInviteRejects(t *testing.T) {
+	previous := auth.Users
+	auth.Users = fakeUsers{
+		"user_noemail": {ID: "user_noemail", Name: "No Email"},
+	}
+	t.Cleanup(func() { auth.Users = previous })
+
+	tests := []struct {
+		name       string
+		userId     string // "" for no session
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"no session", "", `{"token": "abc"}`, http.StatusUnauthorized, ""},
+		{"bad json", "user_noemail", `{"token": `, http.StatusOK, "bad json"},
+		{"no token", "user_noemail", `{}`, http.StatusOK, "bad json"},
+		{"unknown user", "user_missing", `{"token": "abc"}`, http.StatusOK, "generic error"},
+		{"user without email", "user_noemail", `{"token": "abc"}`, http.StatusOK, "invalid invite"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/invite/accept", strings.NewReader(test.body))
+			if test.userId != "" {
+				r = r.WithContext(auth.WithClaims(r.Context(), auth.Claims{Subject: test.userId}))
+			}
+			w := httptest.NewRecorder()
+			AcceptInvite(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if test.wantError == "" {
+				return
+			}
+			var output struct {
+				Response string `json:"response"`
+				Error    string `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &output); err != nil {
+				t.Fatalf("couldn't parse response %q: %v", w.Body.String(), err)
+			}
+			if output.Response != "error" || output.Error != test.wantError {
+				t.Errorf("response = %+v, want error %q", output, test.wantError)
+			}
+		})
+	}
+}
+
+var _ auth.UserDirectory = fakeUsers{}
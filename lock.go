@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-chi/chi/v5"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/observer"
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+	"github.com/posthog/posthog-go"
+)
+
+type FileLock struct {
+	Path      string `json:"path"`
+	OwnerId   string `json:"owner_id"`
+	LockedAt  int64  `json:"locked_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // not set if the lock doesn't expire
+}
+
+type LockRequest struct {
+	Paths []string `json:"paths"`
+	Force bool     `json:"force"` // unlock only: break other users' locks, needs manager permission
+}
+
+type LockOutput struct {
+	Paths []string `json:"paths"` // paths that were locked/unlocked
+}
+
+type LockConflictOutput struct {
+	Locks []FileLock `json:"locks"` // locks held by other users
+}
+
+type LockMissingOutput struct {
+	Paths []string `json:"paths"` // paths that don't exist on main
+}
+
+// input: url param project-id, body {paths}
+// locks all of the paths or none of them. only files that exist on main can be locked,
+// a new file has nothing to check out until it's been committed
+func LockFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request LockRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || len(request.Paths) == 0 {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	if GetProjectPermissionByID(userId, projectId) < 2 {
+		log.Warn("insufficient permission", "user", userId, "projectId", projectId)
+		WriteCustomError(w, "insufficient permission")
+		return
+	}
+
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	// the insert can't touch the same row twice
+	paths := uniquePaths(request.Paths)
+	live, err := qtx.ListLivePaths(ctx, sqlcgen.ListLivePathsParams{
+		Projectid: int32(projectId),
+		Paths:     paths,
+	})
+	if err != nil {
+		log.Error("couldn't get live paths", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	if missing := findMissingPaths(paths, live); len(missing) > 0 {
+		output_bytes, _ := json.Marshal(LockMissingOutput{Paths: missing})
+		PrintResponse(w, "missing", string(output_bytes))
+		return
+	}
+
+	locked, err := qtx.LockFiles(ctx, sqlcgen.LockFilesParams{
+		Projectid: int32(projectId),
+		Paths:     paths,
+		Userid:    userId,
+	})
+	if err != nil {
+		log.Error("couldn't lock files", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	// someone else holds some of the locks, so don't take any of them
+	if len(locked) < len(paths) {
+		held, err := findLocksHeldByOthers(ctx, qtx, projectId, userId, paths)
+		if err != nil {
+			log.Error("couldn't get file locks", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		output_bytes, _ := json.Marshal(LockConflictOutput{Locks: held})
+		PrintResponse(w, "locked", string(output_bytes))
+		return
+	}
+	tx.Commit(ctx)
+
+	observer.PostHogClient.Enqueue(posthog.Capture{
+		DistinctId: userId,
+		Event:      "files-locked",
+		Properties: posthog.NewProperties().
+			Set("project-id", projectId).
+			Set("numberFiles", len(locked)),
+	})
+	output_bytes, _ := json.Marshal(LockOutput{Paths: locked})
+	WriteSuccess(w, string(output_bytes))
+}
+
+// input: url param project-id, body {paths, force}
+// unlocks the caller's locks, or anyone's if force is set
+func UnlockFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request LockRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || len(request.Paths) == 0 {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	permission := GetProjectPermissionByID(userId, projectId)
+	if permission < 2 || (request.Force && permission < 3) {
+		log.Warn("insufficient permission", "user", userId, "projectId", projectId, "force", request.Force)
+		WriteCustomError(w, "insufficient permission")
+		return
+	}
+
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	// remember who held the locks we're about to break
+	var broken []FileLock
+	if request.Force {
+		broken, err = findLocksHeldByOthers(ctx, qtx, projectId, userId, request.Paths)
+		if err != nil {
+			log.Error("couldn't get file locks", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+	}
+
+	unlocked, err := qtx.UnlockFiles(ctx, sqlcgen.UnlockFilesParams{
+		Projectid: int32(projectId),
+		Paths:     request.Paths,
+		Userid:    userId,
+		Force:     request.Force,
+	})
+	if err != nil {
+		log.Error("couldn't unlock files", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	if len(broken) > 0 {
+		err = writeAuditLog(ctx, qtx, projectId, userId, "lock-break", broken)
+		if err != nil {
+			log.Error("couldn't write audit log", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+		log.Info("broke file locks", "user", userId, "project", projectId, "len", len(broken))
+	}
+	tx.Commit(ctx)
+
+	if unlocked == nil {
+		unlocked = make([]string, 0)
+	}
+	output_bytes, _ := json.Marshal(LockOutput{Paths: unlocked})
+	WriteSuccess(w, string(output_bytes))
+}
+
+// input: url param project-id
+// returns every locked path in the project
+func GetProjectLocks(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+
+	if GetProjectPermissionByID(claims.Subject, projectId) < 1 {
+		log.Warn("insufficient permission", "user", claims.Subject, "projectId", projectId)
+		WriteCustomError(w, "insufficient permission")
+		return
+	}
+
+	rows, err := dal.Queries.ListProjectLocks(ctx, int32(projectId))
+	if err != nil {
+		log.Error("couldn't get project locks", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	locks := make([]FileLock, 0, len(rows))
+	for _, row := range rows {
+		locks = append(locks, projectLockToFileLock(row))
+	}
+	output_bytes, _ := json.Marshal(locks)
+	WriteSuccess(w, string(output_bytes))
+}
+
+type StaleLockUser struct {
+	OwnerId    string `json:"owner_id"`
+	NumLocks   int    `json:"num_locks"`
+	OldestLock int64  `json:"oldest_lock"`
+}
+
+type StaleLockOutput struct {
+	Days  int             `json:"days"`
+	Locks []FileLock      `json:"locks"`
+	Users []StaleLockUser `json:"users"` // locks above grouped by owner
+}
+
+// input: url param project-id, query days=<number>
+// returns locks in the project held for longer than days, also grouped by user
+func GetStaleLocks(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 0 {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+
+	if GetProjectPermissionByID(claims.Subject, projectId) < 1 {
+		log.Warn("insufficient permission", "user", claims.Subject, "projectId", projectId)
+		WriteCustomError(w, "insufficient permission")
+		return
+	}
+
+	rows, err := dal.Queries.ListProjectLocks(ctx, int32(projectId))
+	if err != nil {
+		log.Error("couldn't get project locks", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	output := findStaleLocks(rows, time.Now().AddDate(0, 0, -days))
+	output.Days = days
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+// returns the locks taken at or before cutoff, and the same locks grouped by owner
+func findStaleLocks(rows []sqlcgen.ListProjectLocksRow, cutoff time.Time) StaleLockOutput {
+	output := StaleLockOutput{Locks: make([]FileLock, 0), Users: make([]StaleLockUser, 0)}
+	users := make(map[string]int) // owner id -> index in output.Users
+	for _, row := range rows {
+		if row.Lockedat.Time.After(cutoff) {
+			continue
+		}
+		lock := projectLockToFileLock(row)
+		output.Locks = append(output.Locks, lock)
+
+		i, ok := users[lock.OwnerId]
+		if !ok {
+			i = len(output.Users)
+			users[lock.OwnerId] = i
+			output.Users = append(output.Users, StaleLockUser{OwnerId: lock.OwnerId, OldestLock: lock.LockedAt})
+		}
+		output.Users[i].NumLocks++
+		if lock.LockedAt < output.Users[i].OldestLock {
+			output.Users[i].OldestLock = lock.LockedAt
+		}
+	}
+	return output
+}
+
+type LockTimeoutRequest struct {
+	LockTimeout int `json:"lock_timeout"` // hours, 0 for locks that don't expire
+}
+
+// input: url param team-id, body {lock_timeout}
+// sets how long new locks in the team's projects last. existing locks keep their expiry
+func SetTeamLockTimeout(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	teamId, err := strconv.Atoi(chi.URLParam(r, "team-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request LockTimeoutRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.LockTimeout < 0 {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	// team managers and owners only
+	if CheckPermissionByID(teamId, claims.Subject) < 2 {
+		log.Warn("insufficient permission", "user", claims.Subject, "team", teamId)
+		WriteCustomError(w, "insufficient permission")
+		return
+	}
+
+	err = dal.Queries.SetTeamLockTimeout(ctx, sqlcgen.SetTeamLockTimeoutParams{
+		Teamid:      int32(teamId),
+		Locktimeout: int32(request.LockTimeout),
+	})
+	if err != nil {
+		log.Error("couldn't set lock timeout", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	WriteDefaultSuccess(w, "lock timeout updated")
+}
+
+func projectLockToFileLock(row sqlcgen.ListProjectLocksRow) FileLock {
+	lock := FileLock{
+		Path:     row.Path,
+		OwnerId:  row.Lockownerid.String,
+		LockedAt: row.Lockedat.Time.UnixNano() / 1000000000,
+	}
+	if row.Lockexpires.Valid {
+		lock.ExpiresAt = row.Lockexpires.Time.UnixNano() / 1000000000
+	}
+	return lock
+}
+
+// returns the locks on paths that belong to someone other than userId
+func findLocksHeldByOthers(ctx context.Context, q *sqlcgen.Queries, projectId int, userId string, paths []string) ([]FileLock, error) {
+	rows, err := q.ListFileLocks(ctx, sqlcgen.ListFileLocksParams{
+		Projectid: int32(projectId),
+		Paths:     paths,
+	})
+	if err != nil {
+		return nil, err
+	}
+	locks := make([]FileLock, 0)
+	for _, row := range rows {
+		if row.Lockownerid.String == userId {
+			continue
+		}
+		locks = append(locks, FileLock{
+			Path:     row.Path,
+			OwnerId:  row.Lockownerid.String,
+			LockedAt: row.Lockedat.Time.UnixNano() / 1000000000,
+		})
+	}
+	return locks, nil
+}
+
+// returns the paths that aren't in live, in the order they were given
+func findMissingPaths(paths []string, live []string) []string {
+	exists := make(map[string]bool, len(live))
+	for _, path := range live {
+		exists[path] = true
+	}
+	missing := make([]string, 0)
+	for _, path := range paths {
+		if !exists[path] {
+			missing = append(missing, path)
+		}
+	}
+	return missing
+}
+
+func uniquePaths(paths []string) []string {
+	seen := make(map[string]bool, len(paths))
+	unique := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !seen[path] {
+			seen[path] = true
+			unique = append(unique, path)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+)
+
+func TestFindMissingPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		live  []string
+		want  []string
+	}{
+		{"nothing", []string{}, []string{}, []string{}},
+		{"all live", []string{"a", "b"}, []string{"b", "a"}, []string{}},
+		{"none live", []string{"a", "b"}, []string{}, []string{"a", "b"}},
+		{"some live", []string{"c", "a", "b"}, []string{"a"}, []string{"c", "b"}},
+		{"extra live", []string{"a"}, []string{"a", "b"}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := findMissingPaths(test.paths, test.live); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("findMissingPaths() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindStaleLocks(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	lock := func(path string, owner string, age time.Duration, expires time.Duration) sqlcgen.ListProjectLocksRow {
+		row := sqlcgen.ListProjectLocksRow{
+			Path:        path,
+			Lockownerid: pgtype.Text{String: owner, Valid: true},
+			Lockedat:    pgtype.Timestamp{Time: now.Add(-age), Valid: true},
+		}
+		if expires != 0 {
+			row.Lockexpires = pgtype.Timestamp{Time: now.Add(expires), Valid: true}
+		}
+		return row
+	}
+	day := 24 * time.Hour
+	rows := []sqlcgen.ListProjectLocksRow{
+		lock("a", "alex", 10*day, 0),
+		lock("b", "sam", 3*day, day),
+		lock("c", "alex", 20*day, 0),
+		lock("d", "sam", time.Hour, 0),
+		lock("e", "alex", 2*day, 0),
+	}
+	seconds := func(age time.Duration) int64 {
+		return now.Add(-age).Unix()
+	}
+
+	tests := []struct {
+		name   string
+		cutoff time.Time
+		want   StaleLockOutput
+	}{
+		{
+			"none stale",
+			now.Add(-30 * day),
+			StaleLockOutput{Locks: []FileLock{}, Users: []StaleLockUser{}},
+		},
+		{
+			"older than a week",
+			now.Add(-7 * day),
+			StaleLockOutput{
+				Locks: []FileLock{
+					{Path: "a", OwnerId: "alex", LockedAt: seconds(10 * day)},
+					{Path: "c", OwnerId: "alex", LockedAt: seconds(20 * day)},
+				},
+				Users: []StaleLockUser{{OwnerId: "alex", NumLocks: 2, OldestLock: seconds(20 * day)}},
+			},
+		},
+		{
+			"older than two days",
+			now.Add(-2 * day),
+			StaleLockOutput{
+				Locks: []FileLock{
+					{Path: "a", OwnerId: "alex", LockedAt: seconds(10 * day)},
+					{Path: "b", OwnerId: "sam", LockedAt: seconds(3 * day), ExpiresAt: now.Add(day).Unix()},
+					{Path: "c", OwnerId: "alex", LockedAt: seconds(20 * day)},
+					{Path: "e", OwnerId: "alex", LockedAt: seconds(2 * day)},
+				},
+				Users: []StaleLockUser{
+					{OwnerId: "alex", NumLocks: 3, OldestLock: seconds(20 * day)},
+					{OwnerId: "sam", NumLocks: 1, OldestLock: seconds(3 * day)},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := findStaleLocks(rows, test.cutoff); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("findStaleLocks() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
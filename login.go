@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/charmbracelet/log"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
+)
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginOutput struct {
+	Token   string `json:"token"`
+	Expires int64  `json:"expires"`
+}
+
+// input: body {email, password}
+// only routed with AUTH_PROVIDER=local, returns a session token for the Authorization header
+func Login(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	local, ok := auth.Sessions.(*auth.LocalProvider)
+	if !ok {
+		WriteCustomError(w, "disabled")
+		return
+	}
+	var request LoginRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteError(w, BadJson)
+		return
+	}
+
+	token, expires, err := local.Login(ctx, request.Email, request.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	} else if err != nil {
+		log.Error("couldn't log in", "err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	output_bytes, _ := json.Marshal(LoginOutput{Token: token, Expires: expires.Unix()})
+	WriteSuccess(w, string(output_bytes))
+}
@@ -12,16 +12,16 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/jwtauth/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
 	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/notify"
 	"github.com/joshtenorio/glassypdm-server/internal/observer"
 	"github.com/joshtenorio/glassypdm-server/internal/project"
 	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+	"github.com/joshtenorio/glassypdm-server/internal/store"
 	"github.com/posthog/posthog-go"
 
 	"github.com/joho/godotenv"
-
-	"github.com/clerk/clerk-sdk-go/v2"
-	clerkhttp "github.com/clerk/clerk-sdk-go/v2/http"
 )
 
 //go:embed schema.sql
@@ -37,7 +37,7 @@ func main() {
 	log.SetReportCaller(true)
 	log.SetReportTimestamp(true)
 
-	clerk.SetKey(os.Getenv("CLERK_SECRETKEY"))
+	project.InitStoreJWT(os.Getenv("STORE_JWT_SECRET"))
 	PSQLUser := os.Getenv("PSQL_USERNAME")
 	PSQLPass := os.Getenv("PSQL_PASSWORD")
 	PSQLUrl := os.Getenv("PSQL_URL")
@@ -70,13 +70,37 @@ func main() {
 	}
 
 	dal.Queries = *sqlcgen.New(dal.DbPool)
+
+	store.Blobs, err = store.NewFromEnv()
+	if err != nil {
+		log.Fatal("could not set up blob store", "store error", err)
+	}
+
+	provider, err := auth.NewFromEnv()
+	if err != nil {
+		log.Fatal("could not set up auth provider", "auth error", err)
+	}
+	auth.Sessions = provider
+	auth.Users = provider
+
+	notify.Sender, err = notify.NewFromEnv()
+	if err != nil {
+		log.Fatal("could not set up notifier", "notify error", err)
+	}
+
+	if len(os.Args) > 1 {
+		runAdminCommand(ctx, os.Args[1], os.Args[2:])
+		return
+	}
+	startBackgroundJobs(ctx)
+
 	r := chi.NewRouter()
 
 	r.Use(cors.Handler(cors.Options{
 		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST"},
+		AllowedMethods:   []string{"GET", "POST", "PUT"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
@@ -94,17 +118,38 @@ func main() {
 	r.Get("/version", getVersion)
 	r.Get("/client-config", getConfig)
 
-	// TODO protect them
-	r.Post("/store/download", GetS3Download)
-	r.Post("/store/request", HandleUpload)
+	// presigned blob urls carry their own signature
+	if local, ok := store.Blobs.(*store.LocalStore); ok {
+		r.Get("/store/local/{key}", local.RouteGetBlob)
+		r.Put("/store/local/{key}", local.RoutePutBlob)
+	}
+
+	// the local provider signs its own sessions
+	if _, ok := auth.Sessions.(*auth.LocalProvider); ok {
+		r.Post("/auth/login", Login)
+	}
+
+	// store routes take either a store token from /project/{project-id}/store or a session
 	r.Group(func(r chi.Router) {
 		r.Use(jwtauth.Verifier(project.TokenAuth))
-		r.Use(jwtauth.Authenticator(project.TokenAuth))
+		r.Use(project.WithStoreAuthorization(auth.Sessions.Middleware()))
+		r.Post("/store/download", GetS3Download)
+		r.Post("/store/request", HandleUpload)
+		r.Post("/store/negotiate", NegotiateUpload)
+		r.Post("/store/upload/presign", PresignUpload)
+		r.Post("/store/upload/finalize", FinalizeUpload)
+	})
+
+	// archives are meant to be shared as a link, so the store token can also go in ?jwt=
+	r.Group(func(r chi.Router) {
+		r.Use(jwtauth.Verify(project.TokenAuth, jwtauth.TokenFromHeader, jwtauth.TokenFromQuery))
+		r.Use(project.WithStoreAuthorization(auth.Sessions.Middleware()))
+		r.Get("/store/archive/{project-id}", GetProjectArchive)
 	})
 
-	// Clerk-protected routes
+	// session-protected routes
 	r.Group(func(r chi.Router) {
-		r.Use(clerkhttp.WithHeaderAuthorization())
+		r.Use(auth.Sessions.Middleware())
 		r.Get("/permission", GetPermission)
 		r.Post("/permission", SetPermission)
 		r.Post("/commit", CreateCommit)
@@ -115,25 +160,47 @@ func main() {
 		r.Get("/project/commit", RouteGetProjectCommit)
 		r.Get("/project/user", GetProjectsForUser)
 		r.Get("/project/latest", GetProjectLatestCommit) // TODO return more than just commit id
-		//r.Post("/project/restore", RouteProjectRestore)
+		r.Post("/project/restore", RouteProjectRestore)
 		r.Get("/project/status/by-id/{project-id}", GetProjectState) // TODO remove after v0.7.2 is released
 		r.Get("/project/status/by-id/{project-id}/{commit-no}", GetProjectState)
-		//r.Get("/project/{project-id}/store", project.RouteStoreJWTRequest)
+		r.Get("/project/{project-id}/store", GetStoreToken)
+		r.Post("/project/{project-id}/restricted", SetProjectRestricted)
+		r.Get("/project/{project-id}/diff", GetProjectDiff)
+		r.Get("/project/{project-id}/delta", GetProjectDelta)
+		r.Get("/project/{project-id}/file/history", GetFileHistory)
+		r.Post("/project/{project-id}/file/restore", RestoreFile)
+		r.Get("/project/{project-id}/lock", GetProjectLocks)
+		r.Post("/project/{project-id}/lock", LockFiles)
+		r.Get("/project/{project-id}/lock/stale", GetStaleLocks)
+		r.Post("/project/{project-id}/unlock", UnlockFiles)
+		r.Get("/project/{project-id}/tag", GetProjectTags)
+		r.Post("/project/{project-id}/tag", CreateTag)
+		r.Post("/project/{project-id}/tag/delete", DeleteTag)
+		r.Get("/project/{project-id}/branch", GetProjectBranches)
+		r.Post("/project/{project-id}/branch", CreateBranch)
+		r.Post("/project/{project-id}/branch/promote", PromoteBranch)
 		r.Post("/team", CreateTeam)
 		r.Get("/team", GetTeamForUser)
 		r.Get("/team/by-id/{team-id}", getTeamInformation)
 		r.Get("/team/by-name/{team-name}", getTeamInformationByName)
 		r.Get("/team/basic/by-id/{team-id}", GetBasicTeamInfo)
+		r.Post("/team/by-id/{team-id}/locktimeout", SetTeamLockTimeout)
+		r.Post("/team/by-id/{team-id}/member/remove", RemoveTeamMember)
+		r.Post("/team/by-id/{team-id}/owner/transfer", TransferTeamOwnership)
+		r.Get("/team/by-id/{team-id}/invite", GetTeamInvites)
+		r.Post("/team/by-id/{team-id}/invite", CreateInvite)
+		r.Post("/team/by-id/{team-id}/invite/revoke", RevokeInvite)
+		r.Post("/invite/accept", AcceptInvite)
 		r.Get("/team/by-id/{team-id}/pgroup/list", GetPermissionGroups)
 		r.Post("/team/by-id/{team-id}/pgroup/create", CreatePermissionGroup)
 		r.Post("/pgroup/map", CreatePGMapping)
+		r.Post("/pgroup/unmap", RemovePGMapping)
 		r.Get("/pgroup/info", GetPermissionGroupInfo)
 		r.Get("/team/by-id/{team-id}/pgroups/{user-id}", GetPermissionGroupForUser)
 		r.Get("/team/by-id/{team-id}/pgroups", GetPermissionGroupTeamInfo)
-		// remove mapping
 		r.Post("/pgroup/add", AddUserToPG)
 		r.Post("/pgroup/remove", RemoveUserFromPG)
-		// delete permission group
+		r.Post("/pgroup/delete", DeletePermissionGroup)
 	})
 
 	port := os.Getenv("PORT")
@@ -4,14 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/log"
-	"github.com/clerk/clerk-sdk-go/v2"
-	"github.com/clerk/clerk-sdk-go/v2/user"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
 	"github.com/joshtenorio/glassypdm-server/internal/dal"
 	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
 )
@@ -23,7 +24,7 @@ type PGCreationRequest struct {
 
 func CreatePermissionGroup(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -60,13 +61,20 @@ func CreatePermissionGroup(w http.ResponseWriter, r *http.Request) {
 }
 
 type PGMappingRequest struct {
-	ProjectID int `json:"project_id"`
-	PGroupID  int `json:"pgroup_id"`
+	ProjectID int  `json:"project_id"`
+	PGroupID  int  `json:"pgroup_id"`
+	Level     *int `json:"level"` // see ProjectLevel*, write if not given
+}
+
+// a project mapped to a permission group, with the level the group gets
+type PGroupProject struct {
+	Project
+	Level int `json:"level"`
 }
 
 func CreatePGMapping(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -96,9 +104,24 @@ func CreatePGMapping(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// create mapping
+	level := ProjectLevelWrite
+	if request.Level != nil {
+		level = *request.Level
+	}
+	if level < ProjectLevelNone || level > ProjectLevelManage {
+		WriteCustomError(w, "invalid level")
+		return
+	}
+	// the group has to be from the project's team
+	pgroupTeam, err := dal.Queries.GetTeamFromPGroup(ctx, int32(request.PGroupID))
+	if err != nil || pgroupTeam != team {
+		WriteCustomError(w, "invalid permission group")
+		return
+	}
+
+	// create mapping, or change the level of an existing one
 	err = dal.Queries.MapProjectToPermissionGroup(ctx,
-		sqlcgen.MapProjectToPermissionGroupParams{Projectid: int32(request.ProjectID), Pgroupid: int32(request.PGroupID)})
+		sqlcgen.MapProjectToPermissionGroupParams{Projectid: int32(request.ProjectID), Pgroupid: int32(request.PGroupID), Level: int32(level)})
 	if err != nil {
 		// TODO if foreign key constraint, return different error
 		WriteCustomError(w, "db error")
@@ -110,7 +133,7 @@ func CreatePGMapping(w http.ResponseWriter, r *http.Request) {
 
 func GetPermissionGroups(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	_, ok := clerk.SessionClaimsFromContext(r.Context())
+	_, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -145,7 +168,7 @@ type UserPGroupRequest struct {
 
 func RemoveUserFromPG(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -183,9 +206,185 @@ func RemoveUserFromPG(w http.ResponseWriter, r *http.Request) {
 	WriteDefaultSuccess(w, "member removed")
 }
 
+type PGroupRequest struct {
+	PGroupID int `json:"pgroup_id"`
+}
+
+type PGMappingRemoved struct {
+	PGroupId  int `json:"pgroup_id"`
+	ProjectId int `json:"project_id"`
+	Level     int `json:"level"` // level the group had on the project
+}
+
+type DeletePGroupOutput struct {
+	PGroupId   int                `json:"pgroup_id"`
+	PGroupName string             `json:"pgroup_name"`
+	Members    []string           `json:"members"`  // user ids that were in the group
+	Projects   []PGMappingRemoved `json:"projects"` // projects the group was mapped to
+}
+
+// input: body {pgroup_id}
+// deletes a permission group along with its memberships and project mappings
+func DeletePermissionGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+
+	var request PGroupRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	// only managers can delete permission groups
+	team, err := dal.Queries.GetTeamFromPGroup(ctx, int32(request.PGroupID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		WriteCustomError(w, "permission group not found")
+		return
+	} else if err != nil {
+		WriteCustomError(w, "db error")
+		return
+	}
+	if CheckPermissionByID(int(team), userId) < 2 {
+		WriteCustomError(w, "insufficient permission")
+		return
+	}
+
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	members, err := qtx.DropPermissionGroupMembership(ctx, int32(request.PGroupID))
+	if err != nil {
+		log.Error("couldn't drop permission group membership", "pgroup", request.PGroupID, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	mappings, err := qtx.DropPermissionGroupMapping(ctx, int32(request.PGroupID))
+	if err != nil {
+		log.Error("couldn't drop permission group mapping", "pgroup", request.PGroupID, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	name, err := qtx.DeletePermissionGroup(ctx, int32(request.PGroupID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// deleted by someone else in the meantime
+		WriteCustomError(w, "permission group not found")
+		return
+	} else if err != nil {
+		log.Error("couldn't delete permission group", "pgroup", request.PGroupID, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	output := DeletePGroupOutput{
+		PGroupId:   request.PGroupID,
+		PGroupName: name,
+		Members:    make([]string, 0, len(members)),
+		Projects:   make([]PGMappingRemoved, 0, len(mappings)),
+	}
+	output.Members = append(output.Members, members...)
+	for _, mapping := range mappings {
+		output.Projects = append(output.Projects, PGMappingRemoved{PGroupId: request.PGroupID, ProjectId: int(mapping.Projectid), Level: int(mapping.Level)})
+		// the audit log is per project, so note it on every project that lost the grant
+		err = writeAuditLog(ctx, qtx, int(mapping.Projectid), userId, "pgroup-delete", map[string]any{
+			"pgroup_id":   request.PGroupID,
+			"pgroup_name": name,
+			"level":       mapping.Level,
+		})
+		if err != nil {
+			log.Error("couldn't write audit log", "db err", err)
+			WriteCustomError(w, "db error")
+			return
+		}
+	}
+	tx.Commit(ctx)
+
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+// input: body {project_id, pgroup_id}
+// revokes the group's access to the project
+func RemovePGMapping(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+
+	var request PGMappingRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	team, err := dal.Queries.GetTeamFromPGroup(ctx, int32(request.PGroupID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		WriteCustomError(w, "permission group not found")
+		return
+	} else if err != nil {
+		WriteCustomError(w, "db error")
+		return
+	}
+	if CheckPermissionByID(int(team), userId) < 2 {
+		WriteCustomError(w, "insufficient permission")
+		return
+	}
+
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	level, err := qtx.RemoveProjectFromPermissionGroup(ctx,
+		sqlcgen.RemoveProjectFromPermissionGroupParams{Pgroupid: int32(request.PGroupID), Projectid: int32(request.ProjectID)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		WriteCustomError(w, "mapping not found")
+		return
+	} else if err != nil {
+		log.Error("couldn't remove mapping", "pgroup", request.PGroupID, "project", request.ProjectID, "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	err = writeAuditLog(ctx, qtx, request.ProjectID, userId, "pgroup-unmap", map[string]any{
+		"pgroup_id": request.PGroupID,
+		"level":     level,
+	})
+	if err != nil {
+		log.Error("couldn't write audit log", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	tx.Commit(ctx)
+
+	output := PGMappingRemoved{PGroupId: request.PGroupID, ProjectId: request.ProjectID, Level: int(level)}
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
 func AddUserToPG(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -236,7 +435,7 @@ func AddUserToPG(w http.ResponseWriter, r *http.Request) {
 
 func GetPermissionGroupInfo(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -298,7 +497,7 @@ func GetPermissionGroupInfo(w http.ResponseWriter, r *http.Request) {
 	output.TeamMembership = make([]User, 0)
 	output.PGroupMembership = make([]User, 0)
 	output.TeamProjects = make([]Project, 0)
-	output.PGroupProjects = make([]Project, 0)
+	output.PGroupProjects = make([]PGroupProject, 0)
 	for _, project := range TeamProjects {
 		output.TeamProjects = append(output.TeamProjects,
 			Project{Id: int(project.Projectid), Name: project.Title, Team: project.Name})
@@ -306,18 +505,19 @@ func GetPermissionGroupInfo(w http.ResponseWriter, r *http.Request) {
 
 	for _, project := range pgProjects {
 		output.PGroupProjects = append(output.PGroupProjects,
-			Project{Id: int(project.Projectid), Name: project.Title, Team: ""})
+			PGroupProject{Project: Project{Id: int(project.Projectid), Name: project.Title, Team: ""}, Level: int(project.Level)})
 	}
-	// TODO smarter value?
-	clerklist, err := user.List(ctx, &user.ListParams{ListParams: clerk.ListParams{Limit: clerk.Int64(500)}})
+	userIds := append([]string{}, pgMembership...)
+	for _, user := range TeamMembership {
+		userIds = append(userIds, user.Userid)
+	}
+	userlist, err := GetUsersByIDs(userIds)
 	if err != nil {
 		WriteCustomError(w, "clerk error")
 		return
 	}
-	userlist := clerklist.Users
-	log.Info("total users in list:", "count", clerklist.TotalCount)
 	for _, user := range TeamMembership {
-		usr, err := FindUserInList(user.Userid, userlist) //GetUserByID(user.Userid)
+		usr, err := userlist[user.Userid]
 		if !err {
 			log.Warn("couldn't find user", user.Userid)
 			continue
@@ -326,9 +526,9 @@ func GetPermissionGroupInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, boi := range pgMembership {
-		usr, err := FindUserInList(boi, userlist)
+		usr, err := userlist[boi]
 		if !err {
-			log.Warn("couldn't find user", usr)
+			log.Warn("couldn't find user", "user", boi)
 			continue
 		}
 		output.PGroupMembership = append(output.PGroupMembership, usr)
@@ -339,17 +539,17 @@ func GetPermissionGroupInfo(w http.ResponseWriter, r *http.Request) {
 }
 
 type PermissionGroupInfo struct {
-	TeamProjects     []Project `json:"team_projects"`
-	PGroupProjects   []Project `json:"pg_projects"`
-	TeamMembership   []User    `json:"team_membership"`
-	PGroupMembership []User    `json:"pg_membership"`
+	TeamProjects     []Project       `json:"team_projects"`
+	PGroupProjects   []PGroupProject `json:"pg_projects"`
+	TeamMembership   []User          `json:"team_membership"`
+	PGroupMembership []User          `json:"pg_membership"`
 }
 
 type PermissionGroup struct {
-	PGroupId         int       `json:"pgroup_id"`
-	PGroupName       string    `json:"pgroup_name"`
-	PGroupProjects   []Project `json:"pg_projects"`
-	PGroupMembership []string  `json:"pg_membership"`
+	PGroupId         int             `json:"pgroup_id"`
+	PGroupName       string          `json:"pgroup_name"`
+	PGroupProjects   []PGroupProject `json:"pg_projects"`
+	PGroupMembership []string        `json:"pg_membership"`
 }
 type PermissionGroupTeamInfo struct {
 	TeamMembership   []User            `json:"team_membership"`
@@ -365,7 +565,7 @@ type UserPermissionGroups struct {
 
 func GetPermissionGroupTeamInfo(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	_, ok := clerk.SessionClaimsFromContext(r.Context())
+	_, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -389,23 +589,24 @@ func GetPermissionGroupTeamInfo(w http.ResponseWriter, r *http.Request) {
 		output.TeamProjects = append(output.TeamProjects, Project{Id: int(projectDto.Projectid), Name: projectDto.Title})
 	}
 
-	// TODO smarter value?
-	clerklist, err := user.List(ctx, &user.ListParams{ListParams: clerk.ListParams{Limit: clerk.Int64(500)}})
+	users, err := dal.Queries.GetTeamMembership(ctx, int32(teamId))
 	if err != nil {
-		WriteCustomError(w, "clerk error")
+		WriteCustomError(w, "db error")
 		return
 	}
-	userlist := clerklist.Users
-
-	users, err := dal.Queries.GetTeamMembership(ctx, int32(teamId))
+	var userIds []string
+	for _, UserDto := range users {
+		userIds = append(userIds, UserDto.Userid)
+	}
+	userlist, err := GetUsersByIDs(userIds)
 	if err != nil {
-		WriteCustomError(w, "db error")
+		WriteCustomError(w, "clerk error")
 		return
 	}
 	for _, UserDto := range users {
-		user, res := FindUserInList(UserDto.Userid, userlist)
+		user, res := userlist[UserDto.Userid]
 		if !res {
-			log.Warn("userid not found in clerk", "user", UserDto.Userid)
+			log.Warn("userid not found in user directory", "user", UserDto.Userid)
 			continue
 		}
 		output.TeamMembership = append(output.TeamMembership, User{UserId: UserDto.Userid, Name: user.Name, EmailId: ""})
@@ -425,7 +626,7 @@ func GetPermissionGroupTeamInfo(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		for _, MapDto := range mapping {
-			group.PGroupProjects = append(group.PGroupProjects, Project{Id: int(MapDto.Projectid), Team: "", Name: MapDto.Title})
+			group.PGroupProjects = append(group.PGroupProjects, PGroupProject{Project: Project{Id: int(MapDto.Projectid), Team: "", Name: MapDto.Title}, Level: int(MapDto.Level)})
 		}
 
 		members, err := dal.Queries.ListPermissionGroupMembership(ctx, int32(group.PGroupId))
@@ -442,7 +643,7 @@ func GetPermissionGroupTeamInfo(w http.ResponseWriter, r *http.Request) {
 
 func GetPermissionGroupForUser(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
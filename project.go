@@ -8,12 +8,13 @@ import (
 	"strconv"
 
 	"github.com/charmbracelet/log"
-	"github.com/clerk/clerk-sdk-go/v2"
-	"github.com/clerk/clerk-sdk-go/v2/user"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
 	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/observer"
+	"github.com/joshtenorio/glassypdm-server/internal/project"
 	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+	"github.com/posthog/posthog-go"
 )
 
 type Project struct {
@@ -47,12 +48,25 @@ type File struct {
 	Path       string `json:"path"`
 	Hash       string `json:"hash"`
 	ChangeType int    `json:"changetype"`
+	OldPath    string `json:"old_path,omitempty"` // renames only
 }
 
+// filerevision changetypes
+const (
+	ChangeTypeCreate = 1
+	ChangeTypeModify = 2
+	ChangeTypeDelete = 3
+	// the file at old_path moved to path. the old path gets a delete revision
+	// in the same commit, and the file's revision numbers carry over
+	ChangeTypeRename = 4
+)
+
 type CommitRequest struct {
-	ProjectId int    `json:"projectId"`
-	Message   string `json:"message"`
-	Files     []File `json:"files"`
+	ProjectId    int    `json:"projectId"`
+	ParentCommit int    `json:"parent_commit"` // commit number the changes are based on
+	Branch       string `json:"branch"`        // branch name, empty for main
+	Message      string `json:"message"`
+	Files        []File `json:"files"`
 }
 
 type ProjectCreationRequest struct {
@@ -62,7 +76,7 @@ type ProjectCreationRequest struct {
 
 func GetProjectsForUser(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -82,6 +96,10 @@ func GetProjectsForUser(w http.ResponseWriter, r *http.Request) {
 			log.Error("couldn't retrieve team's projects", "teamid", team.Teamid, "err", err.Error())
 		}
 		for _, tp := range TeamProjects {
+			// leave out restricted projects the user can't see
+			if GetProjectPermissionByID(user, int(tp.Projectid)) < ProjectLevelRead {
+				continue
+			}
 			projects = append(projects, Project{Id: int(tp.Projectid), Name: tp.Title, Team: tp.Name, TeamId: int(team.Teamid)})
 		}
 	}
@@ -108,7 +126,7 @@ func GetProjectsForUser(w http.ResponseWriter, r *http.Request) {
 
 func CreateProject(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -154,7 +172,7 @@ func CreateProject(w http.ResponseWriter, r *http.Request) {
 
 func GetProjectInfo(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -170,6 +188,11 @@ func GetProjectInfo(w http.ResponseWriter, r *http.Request) {
 		WriteCustomError(w, "incorrect format")
 		return
 	}
+	permission := GetProjectPermissionByID(claims.Subject, pid)
+	if permission < ProjectLevelRead {
+		WriteCustomError(w, "no permission")
+		return
+	}
 
 	projectname, err := dal.Queries.GetProjectInfo(ctx, int32(pid))
 	if err != nil {
@@ -200,14 +223,8 @@ func GetProjectInfo(w http.ResponseWriter, r *http.Request) {
 
 	}
 
-	permission, err := dal.Queries.GetTeamPermission(ctx, sqlcgen.GetTeamPermissionParams{Teamid: team, Userid: claims.Subject})
-	if err != nil {
-		log.Error("db error", "err", err.Error())
-		fmt.Fprintf(w, `{ "response": "db error", "db": "%s" }`, err.Error())
-		return
-	}
 	var CanManage bool
-	if permission > 1 {
+	if permission >= ProjectLevelManage {
 		CanManage = true
 	} else {
 		CanManage = false
@@ -226,53 +243,75 @@ func GetProjectInfo(w http.ResponseWriter, r *http.Request) {
 	`, projectname, team, teamName, cid, CanManage)
 }
 
-// 0 (not found and not in team): no permission at all
-// 1 (not found but in team): read only
-// 2 (found): write access
-// 3 (manager): manager, can add write access
+// project permission levels, also used for pgmapping.level
+const (
+	ProjectLevelNone   = 0
+	ProjectLevelRead   = 1
+	ProjectLevelWrite  = 2
+	ProjectLevelManage = 3
+)
+
+// 0: not in team, only in groups mapped with no access, or the project is restricted and the user is in no mapped group
+// 1 (in team but in no mapped group, or mapped with read): read only
+// 2 (mapped with write): write access
+// 3 (team manager, or mapped with manage): manager, can add write access
+// a user in several groups mapped to the project gets the highest of their levels
 func GetProjectPermissionByID(userId string, projectId int) int {
 	ctx := context.Background()
 
 	teamId, err := dal.Queries.GetTeamByProject(ctx, int32(projectId))
 	if err != nil {
 		log.Warn("db error", "err", err.Error())
-		return 0
+		return ProjectLevelNone
 	}
 
 	teamPermission := CheckPermissionByID(int(teamId), userId)
-	// not in team: < 1
-	if teamPermission < 1 {
-		return 0
-	} else if teamPermission >= 2 {
-		return 3
+	// only members' access depends on their groups
+	if teamPermission != TeamRoleMember {
+		return projectLevel(teamPermission, -1, false)
 	}
 
-	membership, err := dal.Queries.IsUserInPermissionGroup(ctx, sqlcgen.IsUserInPermissionGroupParams{Userid: userId, Projectid: int32(projectId)})
+	level, err := dal.Queries.GetProjectGroupLevel(ctx, sqlcgen.GetProjectGroupLevelParams{Userid: userId, Projectid: int32(projectId)})
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			log.Debug("user not found in permission group")
-			return 1 // read only
-		}
-
-		log.Error("error grabbing project permission for", "user", userId, "project", projectId)
-		log.Debug("no permission")
-		return 0 // general error/no permission
+		log.Error("error grabbing project permission for", "user", userId, "project", projectId, "err", err)
+		return ProjectLevelNone
 	}
 
-	if membership == userId {
-		log.Debug("write permission")
-		return 2
+	// restricted only matters for members in no mapped group
+	restricted := false
+	if level < 0 {
+		restricted, err = dal.Queries.IsProjectRestricted(ctx, int32(projectId))
+		if err != nil {
+			log.Error("couldn't check if project is restricted", "project", projectId, "err", err)
+			return ProjectLevelNone
+		}
 	}
+	return projectLevel(teamPermission, int(level), restricted)
+}
 
-	log.Error("unhandled case when grabbing project permission", userId, projectId, err)
-	// if we are here, something went wrong
-	return 0
+// works out the levels above from the user's team role, the highest level of their
+// groups mapped to the project (-1 if none are) and whether the project is restricted
+func projectLevel(teamRole int, groupLevel int, restricted bool) int {
+	// not in team: < 1
+	if teamRole < TeamRoleMember {
+		return ProjectLevelNone
+	} else if teamRole >= TeamRoleManager {
+		return ProjectLevelManage
+	}
+	if groupLevel >= 0 {
+		return groupLevel
+	}
+	// in no mapped group
+	if restricted {
+		return ProjectLevelNone
+	}
+	return ProjectLevelRead
 }
 
 // TODO remove after 0.7.2 is released, lmao
 func GetProjectState(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -293,15 +332,11 @@ func GetProjectState(w http.ResponseWriter, r *http.Request) {
 	log.Debug("getting project state:", "c", commitstr)
 	if commitstr != "latest" && commitstr != "" {
 		UseLatest = false
-		commitno, err := strconv.Atoi(commitstr)
-		if err != nil {
-			log.Error("commit number url param is malformed")
-			WriteCustomError(w, "incorrect format")
-			return
-		}
-		CommitId, err = dal.Queries.GetCommitIdFromNo(ctx, sqlcgen.GetCommitIdFromNoParams{Projectid: int32(projectId), Cno: pgtype.Int4{Valid: true, Int32: int32(commitno)}})
+		// commit number or tag name
+		var commitno int
+		CommitId, commitno, err = resolveCommitRef(ctx, projectId, commitstr)
 		if err != nil {
-			log.Error("couldn't find commit number", "cno", commitno, "project", projectId)
+			log.Error("couldn't find commit", "ref", commitstr, "project", projectId)
 			WriteCustomError(w, "what")
 			return
 		}
@@ -350,13 +385,20 @@ func GetProjectState(w http.ResponseWriter, r *http.Request) {
 }
 
 type RestoreProjectRequest struct {
-	CommitId  int `json:"commit_id"`  // commit id to restore project to
-	ProjectId int `json:"project_id"` // project id
+	CommitId  int  `json:"commit_id"`  // commit id on main to restore project to
+	ProjectId int  `json:"project_id"` // project id
+	DryRun    bool `json:"dry_run"`    // only return the changes that would be made
+}
+
+type RestoreProjectOutput struct {
+	CommitId int             `json:"commit_id"` // new commit, 0 for a dry run
+	DryRun   bool            `json:"dry_run"`
+	Changes  []RestoreChange `json:"changes"`
 }
 
 func RouteProjectRestore(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -369,50 +411,95 @@ func RouteProjectRestore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// verify that user is at least a team manager
-	// TODO enum or use TeamRole instead of projectpermission
+	// verify that user can manage the project
 	userId := claims.Subject
 	projectPermission := GetProjectPermissionByID(userId, request.ProjectId)
-	if projectPermission < 3 {
+	if projectPermission < ProjectLevelManage {
 		log.Warn("user does not have permission to restore project state", "levl", projectPermission)
 		WriteCustomError(w, "no permission")
 		return
 	}
 
-	// get number of files that would be updated
-	FileCount, err := dal.Queries.CountFilesUpdatedSinceCommit(ctx, sqlcgen.CountFilesUpdatedSinceCommitParams{
-		Commitid:  int32(request.CommitId),
-		Projectid: int32(request.ProjectId),
-	})
+	// get commit number, and make sure the commit is from this project.
+	// the restore goes on main, so the commit has to be from main too, branches get promoted instead
+	info, err := dal.Queries.GetCommitInfo(ctx, int32(request.CommitId))
+	if err != nil || int(info.Projectid) != request.ProjectId || info.Branchid != 0 {
+		log.Warn("couldn't find commit to restore to", "commit", request.CommitId, "project", request.ProjectId)
+		WriteCustomError(w, "invalid commit")
+		return
+	}
+	// start transaction
+	tx, err := dal.DbPool.Begin(ctx)
 	if err != nil {
-		log.Error("couldn't get number of files updated since", "error", err)
+		log.Error("couldn't create transaction", "error", err)
 		WriteCustomError(w, "db error")
 		return
 	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
 
-	// get commit number
-	info, err := dal.Queries.GetCommitInfo(ctx, int32(request.CommitId))
+	// no other commits while we work out what changed
+	err = qtx.LockProjectForCommit(ctx, int32(request.ProjectId))
 	if err != nil {
-		log.Error("couldn't get commit number for message", "error", err)
+		log.Error("couldn't lock project", "db err", err)
 		WriteCustomError(w, "db error")
 		return
 	}
-	// start transaction
-	tx, err := dal.DbPool.Begin(ctx)
+	head, err := qtx.GetLatestCommit(ctx, int32(request.ProjectId))
 	if err != nil {
-		log.Error("couldn't create transaction", "error", err)
+		log.Error("couldn't get latest commit", "db err", err)
 		WriteCustomError(w, "db error")
 		return
 	}
-	defer tx.Rollback(ctx)
-	qtx := dal.Queries.WithTx(tx)
+	current, err := getRevisionsAtCommit(ctx, qtx, request.ProjectId, head)
+	if err != nil {
+		log.Error("couldn't get current project state", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	target, err := getRevisionsAtCommit(ctx, qtx, request.ProjectId, int32(request.CommitId))
+	if err != nil {
+		log.Error("couldn't get project state at commit", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	changes := diffRevisions(current, target)
+
+	if request.DryRun {
+		output := RestoreProjectOutput{DryRun: true, Changes: changes}
+		output_bytes, _ := json.Marshal(output)
+		WriteSuccess(w, string(output_bytes))
+		return
+	}
+	if len(changes) == 0 {
+		WriteCustomError(w, "nothing to restore")
+		return
+	}
+
+	// a restore is a commit like any other, so it can't overwrite files someone else has checked out
+	var paths []string
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+	locks, err := findLocksHeldByOthers(ctx, qtx, request.ProjectId, userId, paths)
+	if err != nil {
+		log.Error("couldn't check file locks", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	if len(locks) > 0 {
+		log.Warn("restore touches files locked by other users", "project", request.ProjectId, "len", len(locks))
+		output_bytes, _ := json.Marshal(LockConflictOutput{Locks: locks})
+		PrintResponse(w, "locked", string(output_bytes))
+		return
+	}
 
 	// create commit
 	NewCommitId, err := qtx.InsertCommit(ctx, sqlcgen.InsertCommitParams{
 		Projectid: int32(request.ProjectId),
 		Userid:    userId,
 		Comment:   "Restoring project state to Project Update " + strconv.Itoa(int(info.Cno.Int32)),
-		Numfiles:  int32(FileCount)})
+		Numfiles:  int32(len(changes))})
 	if err != nil {
 		log.Error("db couldn't create commit", "db err", err)
 		WriteCustomError(w, "db error")
@@ -420,7 +507,7 @@ func RouteProjectRestore(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// insert new filerevisions
-	err = qtx.RestoreProjectToCommit(ctx, sqlcgen.RestoreProjectToCommitParams{Projectid: int32(request.ProjectId), Commitid: int32(request.CommitId), NewCommit: NewCommitId})
+	err = insertRestoreChanges(ctx, qtx, request.ProjectId, NewCommitId, changes)
 	if err != nil {
 		log.Debug("params", "projectid", int32(request.ProjectId), "commit", int32(request.CommitId), "newcommit", NewCommitId)
 		log.Error("couldnt restore project due to database error", "db err", err)
@@ -428,15 +515,35 @@ func RouteProjectRestore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = writeAuditLog(ctx, qtx, request.ProjectId, userId, "project-restore", map[string]int{
+		"restored_commit": request.CommitId,
+		"new_commit":      int(NewCommitId),
+		"changes":         len(changes),
+	})
+	if err != nil {
+		log.Error("couldn't write audit log", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
 	// commit transaction
 	tx.Commit(ctx)
 
-	WriteDefaultSuccess(w, "pogchamp")
+	observer.PostHogClient.Enqueue(posthog.Capture{
+		DistinctId: userId,
+		Event:      "project-restored",
+		Properties: posthog.NewProperties().
+			Set("project-id", request.ProjectId).
+			Set("numberChanges", len(changes)),
+	})
+	output := RestoreProjectOutput{CommitId: int(NewCommitId), Changes: changes}
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
 }
 
 func RouteGetProjectCommit(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -456,11 +563,6 @@ func RouteGetProjectCommit(w http.ResponseWriter, r *http.Request) {
 		WriteCustomError(w, "incorrect format")
 		return
 	}
-	cno, err := strconv.Atoi(r.URL.Query().Get("cno"))
-	if err != nil {
-		WriteCustomError(w, "incorrect format")
-		return
-	}
 
 	// check permissions
 	if GetProjectPermissionByID(claims.Subject, projectId) < 1 {
@@ -468,9 +570,8 @@ func RouteGetProjectCommit(w http.ResponseWriter, r *http.Request) {
 		WriteCustomError(w, "insufficient permission")
 		return
 	}
-	CommitId, err := dal.Queries.GetCommitIdFromNo(
-		ctx,
-		sqlcgen.GetCommitIdFromNoParams{Projectid: int32(projectId), Cno: pgtype.Int4{Valid: true, Int32: int32(cno)}})
+	// cno can be a commit number or a tag name
+	CommitId, _, err := resolveCommitRef(ctx, projectId, r.URL.Query().Get("cno"))
 	if err != nil {
 		WriteCustomError(w, "db error")
 		return
@@ -496,14 +597,14 @@ func RouteGetProjectCommit(w http.ResponseWriter, r *http.Request) {
 	var Output CommitInformation
 	Output.FilesChanged = Files
 
-	usr, err := user.Get(ctx, CommitInfoDto.Userid)
+	usr, ok := GetUserByID(CommitInfoDto.Userid)
 	name := ""
-	if err != nil {
+	if !ok {
 		log.Error("user invalid", "userid", CommitInfoDto.Userid)
 		WriteCustomError(w, "invalid user id")
 		return
 	}
-	name = *usr.FirstName + " " + *usr.LastName
+	name = usr.Name
 
 	Output.Description = CommitDescription{
 		CommitId:     int(CommitId),
@@ -524,7 +625,7 @@ func RouteGetProjectCommit(w http.ResponseWriter, r *http.Request) {
 
 func GetProjectLatestCommit(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	_, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -539,6 +640,10 @@ func GetProjectLatestCommit(w http.ResponseWriter, r *http.Request) {
 		WriteCustomError(w, "incorrect format")
 		return
 	}
+	if GetProjectPermissionByID(claims.Subject, pid) < ProjectLevelRead {
+		WriteCustomError(w, "no permission")
+		return
+	}
 	hehez, err := dal.Queries.GetLatestCommit(ctx, int32(pid))
 	if err != nil {
 		WriteCustomError(w, "db error")
@@ -546,3 +651,118 @@ func GetProjectLatestCommit(w http.ResponseWriter, r *http.Request) {
 	}
 	WriteSuccess(w, strconv.Itoa(int(hehez)))
 }
+
+type StoreTokenOutput struct {
+	Token     string `json:"token"`
+	ProjectId int    `json:"project_id"`
+	Action    string `json:"action"`
+	Expires   int64  `json:"expires"`
+}
+
+// input: query action=upload|download
+// returns a short-lived token the store routes accept in place of a session
+func GetStoreToken(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+	if action != project.StoreActionUpload && action != project.StoreActionDownload {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	isDownload := action == project.StoreActionDownload
+
+	// check if user can upload/download to/from the project
+	if !canUseStore(claims.Subject, nil, projectId, isDownload) {
+		log.Warn("insufficient permission for store token", "user", claims.Subject, "projectId", projectId, "action", action)
+		WriteCustomError(w, "insufficient permission")
+		return
+	}
+
+	token, expires, err := project.RequestStoreJWT(claims.Subject, projectId, isDownload)
+	if err != nil {
+		log.Error("couldn't create store token", "err", err.Error())
+		WriteCustomError(w, "generic error")
+		return
+	}
+
+	output := StoreTokenOutput{Token: token, ProjectId: projectId, Action: action, Expires: expires.Unix()}
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+type SetRestrictedRequest struct {
+	Restricted bool `json:"restricted"`
+}
+
+// input: url param project-id, body {restricted}
+// restricted projects are only visible to team managers and members of permission groups mapped to them
+func SetProjectRestricted(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request SetRestrictedRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	// only team managers, a permission group with manage access can't lock other people out
+	teamId, err := dal.Queries.GetTeamByProject(ctx, int32(projectId))
+	if err != nil {
+		WriteCustomError(w, "project not found")
+		return
+	}
+	if CheckPermissionByID(int(teamId), userId) < 2 {
+		log.Warn("insufficient permission", "user", userId, "projectId", projectId)
+		WriteCustomError(w, "no permission")
+		return
+	}
+
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	err = qtx.SetProjectRestricted(ctx, sqlcgen.SetProjectRestrictedParams{Projectid: int32(projectId), Restricted: request.Restricted})
+	if err != nil {
+		log.Error("couldn't set project restriction", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	err = writeAuditLog(ctx, qtx, projectId, userId, "project-restrict", map[string]any{
+		"restricted": request.Restricted,
+	})
+	if err != nil {
+		log.Error("couldn't write audit log", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	tx.Commit(ctx)
+
+	WriteDefaultSuccess(w, "project updated")
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestProjectLevel(t *testing.T) {
+	tests := []struct {
+		name       string
+		teamRole   int
+		groupLevel int
+		restricted bool
+		want       int
+	}{
+		{"not in team", 0, -1, false, ProjectLevelNone},
+		{"not in team but mapped", 0, ProjectLevelManage, false, ProjectLevelNone},
+		{"member in no group", TeamRoleMember, -1, false, ProjectLevelRead},
+		{"member in no group restricted", TeamRoleMember, -1, true, ProjectLevelNone},
+		{"mapped with no access", TeamRoleMember, ProjectLevelNone, false, ProjectLevelNone},
+		{"mapped with read", TeamRoleMember, ProjectLevelRead, false, ProjectLevelRead},
+		{"mapped with write", TeamRoleMember, ProjectLevelWrite, false, ProjectLevelWrite},
+		{"mapped with manage", TeamRoleMember, ProjectLevelManage, false, ProjectLevelManage},
+		{"mapped on restricted", TeamRoleMember, ProjectLevelWrite, true, ProjectLevelWrite},
+		{"manager", TeamRoleManager, -1, false, ProjectLevelManage},
+		{"manager restricted", TeamRoleManager, -1, true, ProjectLevelManage},
+		{"manager mapped with no access", TeamRoleManager, ProjectLevelNone, false, ProjectLevelManage},
+		{"owner", TeamRoleOwner, -1, true, ProjectLevelManage},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := projectLevel(test.teamRole, test.groupLevel, test.restricted); got != test.want {
+				t.Errorf("projectLevel() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
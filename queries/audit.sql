@@ -0,0 +1,4 @@
+-- name: InsertAuditLog :exec
+INSERT INTO auditlog(projectid, userid, action, detail)
+VALUES ($1, $2, $3, $4);
+
@@ -0,0 +1,42 @@
+-- name: InsertBranch :one
+INSERT INTO branch(projectid, name, basecommit, userid)
+VALUES ($1, $2, $3, $4)
+RETURNING branchid;
+
+-- name: GetBranchByName :one
+SELECT branchid, basecommit, promoted FROM branch
+WHERE projectid = $1 AND name = $2
+LIMIT 1;
+
+-- the branch's last commit, or its base commit if nothing has been committed to it since it was made or promoted
+-- name: GetBranchHead :one
+SELECT GREATEST(MAX(commit.commitid), branch.basecommit)::integer AS headcommit FROM branch
+LEFT JOIN commit ON commit.branchid = branch.branchid
+WHERE branch.branchid = $1
+GROUP BY branch.basecommit;
+
+-- name: GetBranchPromoted :one
+SELECT promoted FROM branch
+WHERE branchid = $1;
+
+-- name: ListProjectBranches :many
+SELECT branch.branchid, branch.name, branch.basecommit, branch.promoted, branch.userid, branch.timestamp,
+GREATEST(( SELECT MAX(commit.commitid) FROM commit WHERE commit.branchid = branch.branchid ), branch.basecommit)::integer AS headcommit
+FROM branch
+WHERE branch.projectid = $1
+ORDER BY branch.name;
+
+-- paths changed on a branch after a commit
+-- name: ListBranchChangedPaths :many
+SELECT DISTINCT filerevision.path FROM filerevision
+INNER JOIN commit ON commit.commitid = filerevision.commitid
+WHERE commit.branchid = $1 AND commit.commitid > $2;
+
+-- moves a branch's commits after a commit onto main
+-- name: FastForwardBranch :execrows
+UPDATE commit SET branchid = 0
+WHERE branchid = $1 AND commitid > $2;
+
+-- name: SetBranchPromoted :exec
+UPDATE branch SET basecommit = $2, promoted = $3
+WHERE branchid = $1;
@@ -0,0 +1,38 @@
+-- name: ListOrphanedChunks :many
+SELECT filehash, chunkindex, blockhash, blocksize FROM chunk
+WHERE created < NOW() - (@grace_seconds::int * INTERVAL '1 second')
+AND NOT EXISTS (
+    SELECT 1 FROM filerevision WHERE filerevision.filehash = chunk.filehash
+);
+
+-- name: DeleteOrphanedChunks :many
+DELETE FROM chunk
+WHERE created < NOW() - (@grace_seconds::int * INTERVAL '1 second')
+AND NOT EXISTS (
+    SELECT 1 FROM filerevision WHERE filerevision.filehash = chunk.filehash
+)
+RETURNING filehash, chunkindex, blockhash, blocksize;
+
+-- a block is orphaned once every chunk pointing at it is also orphaned
+-- name: ListOrphanedBlocks :many
+SELECT blockhash, s3key, blocksize FROM block
+WHERE created < NOW() - (@grace_seconds::int * INTERVAL '1 second')
+AND NOT EXISTS (
+    SELECT 1 FROM chunk
+    WHERE chunk.blockhash = block.blockhash
+    AND (chunk.created >= NOW() - (@grace_seconds::int * INTERVAL '1 second')
+        OR EXISTS (SELECT 1 FROM filerevision WHERE filerevision.filehash = chunk.filehash))
+);
+
+-- name: DeleteOrphanedBlock :one
+DELETE FROM block
+WHERE blockhash = $1 AND NOT EXISTS (
+    SELECT 1 FROM chunk WHERE chunk.blockhash = block.blockhash
+)
+RETURNING s3key;
+
+-- name: ListBlockKeys :many
+SELECT s3key FROM block;
+
+-- name: BlockKeyExists :one
+SELECT EXISTS ( SELECT 1 FROM block WHERE s3key = $1 )::boolean;
@@ -0,0 +1,21 @@
+-- name: InsertInvite :one
+INSERT INTO invite(teamid, email, level, tokenhash, userid, expires)
+VALUES(@teamid, @email, @level, @tokenhash, @userid, NOW() + @days::integer * INTERVAL '1 day')
+RETURNING inviteid, expires;
+
+-- invites that haven't been accepted, revoked, or expired, newest first
+-- name: ListPendingInvites :many
+SELECT inviteid, email, level, userid, timestamp, expires FROM invite
+WHERE teamid = $1 AND acceptedby IS NULL AND revoked = FALSE AND expires > NOW()
+ORDER BY timestamp DESC;
+
+-- name: RevokeInvite :one
+UPDATE invite SET revoked = TRUE
+WHERE inviteid = $1 AND teamid = $2 AND acceptedby IS NULL AND revoked = FALSE
+RETURNING email;
+
+-- binds a pending invite to userid if it was sent to their email, returns the team and level it grants
+-- name: AcceptInvite :one
+UPDATE invite SET acceptedby = @userid::text, acceptedat = NOW()
+WHERE tokenhash = @tokenhash AND email = LOWER(@email::text) AND acceptedby IS NULL AND revoked = FALSE AND expires > NOW()
+RETURNING teamid, level;
@@ -0,0 +1,58 @@
+-- name: ListProjectLocks :many
+SELECT path, lockownerid, lockedat, lockexpires FROM file
+WHERE projectid = $1 AND locked = 1 AND (lockexpires IS NULL OR lockexpires > NOW())
+ORDER BY path;
+
+-- name: ListFileLocks :many
+SELECT path, lockownerid, lockedat FROM file
+WHERE projectid = @projectid AND locked = 1 AND (lockexpires IS NULL OR lockexpires > NOW()) AND path = ANY(@paths::text[])
+ORDER BY path;
+
+-- which of the paths exist on main, i.e. their latest revision there isn't a delete
+-- name: ListLivePaths :many
+SELECT a.path FROM filerevision a
+INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = @projectid AND filerevision.path = ANY(@paths::text[])
+    AND filerevision.commitid IN ( SELECT commitid FROM commit WHERE commit.projectid = @projectid AND commit.branchid = 0 ) GROUP BY path ) b
+ON a.path = b.path AND a.frid = b.frid
+WHERE a.projectid = @projectid AND a.changetype != 3;
+
+-- locks paths that are unlocked, expired, or already locked by userid, returns the paths that were locked.
+-- the lock expires after the team's lock timeout, if it has one.
+-- locking a path again while holding it keeps the original lock time and expiry, so a lock can't be kept forever.
+-- locks taken before the team had a timeout pick it up when they're locked again
+-- name: LockFiles :many
+INSERT INTO file(projectid, path, locked, lockownerid, lockedat, lockexpires)
+SELECT @projectid::integer, unnest(@paths::text[]), 1, @userid::text, NOW(), (
+    SELECT CASE WHEN team.locktimeout > 0 THEN NOW() + team.locktimeout * INTERVAL '1 hour' END
+    FROM project INNER JOIN team ON team.teamid = project.teamid
+    WHERE project.projectid = @projectid::integer
+)
+ON CONFLICT(projectid, path) DO UPDATE SET locked = 1, lockownerid = EXCLUDED.lockownerid,
+    lockedat = CASE WHEN file.locked = 1 AND file.lockownerid = EXCLUDED.lockownerid AND (file.lockexpires IS NULL OR file.lockexpires >= NOW()) THEN file.lockedat ELSE EXCLUDED.lockedat END,
+    lockexpires = CASE WHEN file.locked = 1 AND file.lockownerid = EXCLUDED.lockownerid AND file.lockexpires >= NOW() THEN file.lockexpires ELSE EXCLUDED.lockexpires END
+WHERE file.locked = 0 OR file.lockownerid = EXCLUDED.lockownerid OR file.lockexpires < NOW()
+RETURNING path;
+
+-- unlocks paths locked by userid, or by anyone if force is set. returns the paths that were unlocked
+-- name: UnlockFiles :many
+UPDATE file SET locked = 0, lockownerid = NULL, lockedat = NULL, lockexpires = NULL
+WHERE projectid = @projectid AND locked = 1 AND path = ANY(@paths::text[])
+AND (lockownerid = @userid::text OR @force::boolean)
+RETURNING path;
+
+-- releases every lock past its expiry
+-- name: ExpireLocks :many
+UPDATE file SET locked = 0, lockownerid = NULL, lockedat = NULL, lockexpires = NULL
+WHERE locked = 1 AND lockexpires < NOW()
+RETURNING projectid, path;
+
+-- releases every lock the user holds in the team's projects
+-- name: ReleaseUserTeamLocks :many
+UPDATE file SET locked = 0, lockownerid = NULL, lockedat = NULL, lockexpires = NULL
+WHERE locked = 1 AND lockownerid = $1
+AND projectid IN (SELECT projectid FROM project WHERE teamid = $2)
+RETURNING projectid, path;
+
+-- name: SetTeamLockTimeout :exec
+UPDATE team SET locktimeout = $2
+WHERE teamid = $1;
@@ -4,8 +4,10 @@ INSERT INTO permissiongroup(teamid, name) VALUES($1, $2);
 -- name: AddMemberToPermissionGroup :exec
 INSERT INTO pgmembership(pgroupid, userid) VALUES($1, $2);
 
+-- mapping a group that's already mapped changes its level
 -- name: MapProjectToPermissionGroup :exec
-INSERT INTO pgmapping(pgroupid, projectid) VALUES($1, $2);
+INSERT INTO pgmapping(pgroupid, projectid, level) VALUES($1, $2, $3)
+ON CONFLICT(pgroupid, projectid) DO UPDATE SET level = excluded.level;
 
 -- name: ListPermissionGroupForTeam :many
 SELECT pg.pgroupid, pg.name, count(pgm.userid) as count
@@ -16,23 +18,33 @@ WHERE pg.teamid = $1 GROUP BY pg.pgroupid;
 SELECT userid FROM pgmembership WHERE pgroupid = $1;
 
 -- name: GetPermissionGroupMapping :many
-SELECT p.projectid, p.title FROM pgmapping pg, project p
+SELECT p.projectid, p.title, pg.level FROM pgmapping pg, project p
 WHERE pg.pgroupid = $1 AND pg.projectid = p.projectid;
 
 -- name: RemoveMemberFromPermissionGroup :exec
 DELETE FROM pgmembership WHERE pgroupid = $1 AND userid = $2;
 
--- name: RemoveProjectFromPermissionGroup :exec
-DELETE FROM pgmapping WHERE pgroupid = $1 AND projectid = $2;
+-- name: RemoveProjectFromPermissionGroup :one
+DELETE FROM pgmapping WHERE pgroupid = $1 AND projectid = $2
+RETURNING level;
 
--- name: DropPermissionGroupMembership :exec
-DELETE FROM pgmembership WHERE pgroupid = $1;
+-- removes the user from every permission group in the team
+-- name: RemoveMemberFromTeamPermissionGroups :many
+DELETE FROM pgmembership WHERE userid = $1
+AND pgroupid IN (SELECT pgroupid FROM permissiongroup WHERE teamid = $2)
+RETURNING pgroupid;
 
--- name: DropPermissionGroupMapping :exec
-DELETE FROM pgmapping WHERE pgroupid = $1;
+-- name: DropPermissionGroupMembership :many
+DELETE FROM pgmembership WHERE pgroupid = $1
+RETURNING userid;
 
--- name: DeletePermissionGroup :exec
-DELETE FROM permissiongroup WHERE pgroupid = $1;
+-- name: DropPermissionGroupMapping :many
+DELETE FROM pgmapping WHERE pgroupid = $1
+RETURNING projectid, level;
+
+-- name: DeletePermissionGroup :one
+DELETE FROM permissiongroup WHERE pgroupid = $1
+RETURNING name;
 
 -- name: FindUserInPermissionGroup :many
 SELECT pgroupid FROM pgmembership WHERE
@@ -42,6 +54,13 @@ userid = $1;
 SELECT userid FROM pgmembership pgme, pgmapping pgma WHERE
 pgme.userid = $1 AND pgma.projectid = $2 AND pgma.pgroupid = pgme.pgroupid;
 
+-- highest level the user gets on the project from their permission groups,
+-- -1 if none of their groups are mapped to it
+-- name: GetProjectGroupLevel :one
+SELECT COALESCE(MAX(pgma.level), -1)::integer AS level FROM pgmembership pgme
+INNER JOIN pgmapping pgma ON pgma.pgroupid = pgme.pgroupid
+WHERE pgme.userid = $1 AND pgma.projectid = $2;
+
 -- name: GetTeamFromPGroup :one
 SELECT teamid FROM permissiongroup WHERE
 pgroupid = $1 LIMIT 1;
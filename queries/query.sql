@@ -24,6 +24,12 @@ SELECT level FROM teampermission
 WHERE teamid = $1 AND userid = $2
 LIMIT 1;
 
+-- locks the user's row so the team's owner can't change underneath us
+-- name: GetTeamPermissionForUpdate :one
+SELECT level FROM teampermission
+WHERE teamid = $1 AND userid = $2
+FOR UPDATE;
+
 -- name: SetTeamPermission :one
 INSERT INTO teampermission(userid, teamid, level)
 VALUES($1, $2, $3) ON CONFLICT(userid, teamid) DO UPDATE SET level=excluded.level
@@ -31,7 +37,7 @@ RETURNING *;
 
 -- name: DeleteTeamPermission :one
 DELETE FROM teampermission
-WHERE userid = $1
+WHERE userid = $1 AND teamid = $2
 RETURNING *;
 
 -- name: FindUserTeams :many
@@ -64,13 +70,22 @@ RETURNING projectid;
 SELECT title FROM project
 WHERE projectid = $1 LIMIT 1;
 
+-- name: IsProjectRestricted :one
+SELECT restricted FROM project
+WHERE projectid = $1 LIMIT 1;
+
+-- name: SetProjectRestricted :exec
+UPDATE project SET restricted = $2
+WHERE projectid = $1;
+
 -- name: GetUploadPermission :one
 SELECT COUNT(*) FROM teampermission
 WHERE userid = $1 LIMIT 1;
 
+-- head of main
 -- name: GetLatestCommit :one
 SELECT CAST(MAX(commitid) AS INTEGER) FROM commit
-WHERE projectid = $1;
+WHERE projectid = $1 AND branchid = 0;
 
 -- name: InsertTeam :one
 INSERT INTO team(name)
@@ -78,8 +93,8 @@ VALUES ($1)
 RETURNING teamid;
 
 -- name: InsertCommit :one
-INSERT INTO commit(projectid, userid, comment, numfiles)
-VALUES ($1, $2, $3, $4)
+INSERT INTO commit(projectid, userid, comment, numfiles, branchid)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING commitid;
 
 -- name: InsertFile :exec
@@ -104,26 +119,30 @@ WHERE projectid = $1 AND path = $2 AND commitid = $3 LIMIT 1;
 
 -- name: GetProjectState :many
 SELECT a.frid, a.path, a.commitid, a.filehash, a.changetype, a.filesize as blocksize FROM filerevision a
-INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = $1 GROUP BY path ) b
+INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = $1
+    AND filerevision.commitid IN ( SELECT commitid FROM commit WHERE commit.projectid = $1 AND commit.branchid = 0 ) GROUP BY path ) b
 ON a.path = b.path AND a.frid = b.frid
 WHERE a.projectid = $1;
 
 -- name: GetProjectStateAtCommit :many
 SELECT a.frid, a.path, a.commitid, a.filehash, a.changetype, a.filesize as blocksize FROM filerevision a
-INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.commitid <= $2 AND filerevision.projectid = $1 GROUP BY path  ) b
+INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = @projectid
+    AND filerevision.commitid IN ( SELECT commitid FROM commit_ancestry(@projectid, @commitid) ) GROUP BY path ) b
 ON a.path = b.path AND a.frid = b.frid
-WHERE a.projectid = $1 AND a.commitid <= $2;
+WHERE a.projectid = @projectid;
 
+-- latest revision as of to_commit for every path that was changed after from_commit.
+-- from_commit has to be on to_commit's lineage, paths only from_commit's side has aren't returned
 -- name: GetProjectDiffBetweenCommits :many
-SELECT a.frid, a.path, a.commitid, a.filehash, a.changetype, a.filesize as blocksize FROM filerevision a
-INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision GROUP BY path ) b
+SELECT a.frid, a.path, a.commitid, a.filehash, a.changetype, a.filesize as blocksize, a.oldpath FROM filerevision a
+INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = @projectid
+    AND filerevision.commitid IN ( SELECT commitid FROM commit_ancestry(@projectid, @to_commit) ) GROUP BY path ) b
 ON a.path = b.path AND a.frid = b.frid
-WHERE a.projectid = $1 AND a.commitid <= $2
-INTERSECT
-SELECT a.frid, a.path, a.commitid, a.filehash, a.changetype, a.filesize as blocksize FROM filerevision a
-INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision GROUP BY path ) b
-ON a.path = b.path AND a.frid = b.frid
-WHERE a.projectid = $1 AND a.commitid <= $3;
+WHERE a.projectid = @projectid AND a.path IN (
+    SELECT path FROM filerevision WHERE filerevision.projectid = @projectid
+    AND (filerevision.commitid IN ( SELECT commitid FROM commit_ancestry(@projectid, @to_commit) ))
+    <> (filerevision.commitid IN ( SELECT commitid FROM commit_ancestry(@projectid, @from_commit) ))
+);
 
 -- name: GetProjectLivingFiles :many
 SELECT a.frid, a.path FROM filerevision a
@@ -133,13 +152,13 @@ WHERE a.projectid = $1 AND changetype != 3;
 
 -- name: ListProjectCommits :many
 SELECT cno, numfiles, userid, comment, commitid, timestamp FROM commit
-WHERE projectid = $1
+WHERE projectid = $1 AND branchid = $4
 ORDER BY commitid DESC
 LIMIT $3 OFFSET $2;
 
 -- name: CountProjectCommits :one
 SELECT COUNT(commitid) FROM commit
-WHERE projectid = $1
+WHERE projectid = $1 AND branchid = $2
 LIMIT 1;
 
 -- name: GetCommitInfo :one
@@ -149,7 +168,8 @@ SELECT
   timestamp,
   comment,
   numfiles,
-  projectid
+  projectid,
+  branchid
 FROM commit
 WHERE
   commitid = $1 LIMIT 1;
@@ -159,9 +179,13 @@ SELECT frid as filerevision_id, path, frno as filerevision_number, changetype, f
 FROM filerevision
 WHERE commitid = $1;
 
--- TODO
--- name: RestoreProjectToCommit :exec
-SELECT * FROM commit WHERE numfiles = sqlc.arg(new_commit) and projectid = $2 and commitid = $1;
+-- latest revision of every path in the project as of a commit, including deleted paths
+-- name: GetLatestRevisionsAtCommit :many
+SELECT a.path, a.filehash, a.changetype, a.numchunks, a.filesize, a.oldpath FROM filerevision a
+INNER JOIN ( SELECT path, MAX(frid) frid FROM filerevision WHERE filerevision.projectid = @projectid
+    AND filerevision.commitid IN ( SELECT commitid FROM commit_ancestry(@projectid, @commitid) ) GROUP BY path ) b
+ON a.path = b.path AND a.frid = b.frid
+WHERE a.projectid = @projectid;
 
 -- name: CountFilesUpdatedSinceCommit :one
 SELECT COUNT(distinct path) FROM filerevision WHERE
@@ -177,4 +201,105 @@ SELECT EXISTS (
     SELECT 1
     FROM teampermission
     WHERE userid = $1 AND teamid = $2
-);
\ No newline at end of file
+);
+
+-- serializes commits to a project until the transaction ends
+-- name: LockProjectForCommit :exec
+SELECT projectid FROM project
+WHERE projectid = $1
+FOR UPDATE;
+
+-- paths changed after the parent commit on the way to head_commit
+-- name: FindConflictingPaths :many
+SELECT DISTINCT path FROM filerevision
+WHERE projectid = @projectid AND commitid > @parent_commit AND path = ANY(@paths::text[])
+AND commitid IN ( SELECT commitid FROM commit_ancestry(@projectid, @head_commit) );
+
+-- whether commitid is head_commit or comes before it
+-- name: IsAncestorCommit :one
+SELECT EXISTS ( SELECT 1 FROM commit_ancestry(@projectid, @head_commit) ancestry WHERE ancestry.commitid = @commitid )::boolean;
+
+-- renumbers duplicate commit/file revision numbers, returns how many rows changed
+-- name: RepairNumbering :one
+SELECT repair_numbering()::integer AS renumbered;
+
+-- revisions of a file on main, following it back through renames:
+-- each lineage row is a path and the frid range the file lived there
+-- name: ListFileHistory :many
+WITH RECURSIVE lineage(path, lowerfrid, upperfrid) AS (
+    SELECT @path::text, COALESCE((
+        SELECT MAX(frid) FROM filerevision WHERE projectid = @projectid::integer AND path = @path::text AND changetype = 4
+        AND commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), 2147483647
+    UNION ALL
+    SELECT renamed.oldpath, COALESCE((
+        SELECT MAX(prev.frid) FROM filerevision prev
+        WHERE prev.projectid = renamed.projectid AND prev.path = renamed.oldpath AND prev.changetype = 4 AND prev.frid < renamed.frid
+        AND prev.commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), renamed.frid
+    FROM lineage INNER JOIN filerevision renamed ON renamed.frid = lineage.lowerfrid
+    WHERE renamed.oldpath IS NOT NULL
+)
+SELECT filerevision.path, filerevision.oldpath, filerevision.frno, filerevision.filehash, filerevision.changetype, filerevision.filesize,
+commit.commitid, commit.cno, commit.userid, commit.comment, commit.timestamp
+FROM filerevision
+INNER JOIN lineage ON filerevision.path = lineage.path AND filerevision.frid >= lineage.lowerfrid AND filerevision.frid < lineage.upperfrid
+INNER JOIN commit ON commit.commitid = filerevision.commitid
+WHERE filerevision.projectid = @projectid::integer AND commit.branchid = 0
+ORDER BY filerevision.frid DESC
+LIMIT sqlc.arg(page_size) OFFSET sqlc.arg(page_offset);
+
+-- same lineage as ListFileHistory
+-- name: CountFileRevisions :one
+WITH RECURSIVE lineage(path, lowerfrid, upperfrid) AS (
+    SELECT @path::text, COALESCE((
+        SELECT MAX(frid) FROM filerevision WHERE projectid = @projectid::integer AND path = @path::text AND changetype = 4
+        AND commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), 2147483647
+    UNION ALL
+    SELECT renamed.oldpath, COALESCE((
+        SELECT MAX(prev.frid) FROM filerevision prev
+        WHERE prev.projectid = renamed.projectid AND prev.path = renamed.oldpath AND prev.changetype = 4 AND prev.frid < renamed.frid
+        AND prev.commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), renamed.frid
+    FROM lineage INNER JOIN filerevision renamed ON renamed.frid = lineage.lowerfrid
+    WHERE renamed.oldpath IS NOT NULL
+)
+SELECT COUNT(*) FROM filerevision
+INNER JOIN lineage ON filerevision.path = lineage.path AND filerevision.frid >= lineage.lowerfrid AND filerevision.frid < lineage.upperfrid
+INNER JOIN commit ON commit.commitid = filerevision.commitid
+WHERE filerevision.projectid = @projectid::integer AND commit.branchid = 0;
+
+-- latest revision of a path as of a commit
+-- name: GetFileRevisionAtCommit :one
+SELECT path, filehash, changetype, numchunks, filesize, oldpath FROM filerevision
+WHERE projectid = @projectid AND path = @path AND commitid IN ( SELECT commitid FROM commit_ancestry(@projectid, @commitid) )
+ORDER BY frid DESC
+LIMIT 1;
+
+-- a revision of a file on main by its number, on the same lineage as ListFileHistory
+-- name: GetFileRevisionByNumber :one
+WITH RECURSIVE lineage(path, lowerfrid, upperfrid) AS (
+    SELECT @path::text, COALESCE((
+        SELECT MAX(frid) FROM filerevision WHERE projectid = @projectid::integer AND path = @path::text AND changetype = 4
+        AND commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), 2147483647
+    UNION ALL
+    SELECT renamed.oldpath, COALESCE((
+        SELECT MAX(prev.frid) FROM filerevision prev
+        WHERE prev.projectid = renamed.projectid AND prev.path = renamed.oldpath AND prev.changetype = 4 AND prev.frid < renamed.frid
+        AND prev.commitid IN ( SELECT commitid FROM commit WHERE commit.branchid = 0 )
+    ), 0), renamed.frid
+    FROM lineage INNER JOIN filerevision renamed ON renamed.frid = lineage.lowerfrid
+    WHERE renamed.oldpath IS NOT NULL
+)
+SELECT filerevision.path, filerevision.filehash, filerevision.changetype, filerevision.numchunks, filerevision.filesize, filerevision.oldpath FROM filerevision
+INNER JOIN lineage ON filerevision.path = lineage.path AND filerevision.frid >= lineage.lowerfrid AND filerevision.frid < lineage.upperfrid
+INNER JOIN commit ON commit.commitid = filerevision.commitid
+WHERE filerevision.projectid = @projectid::integer AND commit.branchid = 0 AND filerevision.frno = @frno
+ORDER BY filerevision.frid DESC
+LIMIT 1;
+
+-- name: InsertRenameRevision :exec
+INSERT INTO filerevision(projectid, path, commitid, filehash, numchunks, changetype, oldpath)
+VALUES (@projectid, @path, @commitid, @filehash, @numchunks, 4, @oldpath::text);
@@ -14,5 +14,33 @@ SELECT s3key FROM block
 WHERE blockhash = $1 LIMIT 1;
 
 -- name: GetFileChunks :many
-SELECT blockhash, chunkindex FROM chunk
+SELECT blockhash, chunkindex, blocksize FROM chunk
 WHERE filehash = $1 ORDER BY chunkindex ASC;
+
+-- name: FindExistingBlocks :many
+SELECT blockhash FROM block
+WHERE blockhash = ANY(@blockhashes::text[]);
+
+-- name: FindTeamBlocks :many
+SELECT blockhash FROM teamblock
+WHERE teamid = @teamid AND blockhash = ANY(@blockhashes::text[]);
+
+-- name: InsertTeamBlock :exec
+INSERT INTO teamblock(teamid, blockhash) VALUES ($1, $2)
+ON CONFLICT(teamid, blockhash) DO NOTHING;
+
+-- only lists chunks whose block the team has
+-- name: ListFileChunkIndexes :many
+SELECT chunk.filehash, chunk.chunkindex, chunk.numchunks FROM chunk
+INNER JOIN teamblock ON teamblock.blockhash = chunk.blockhash AND teamblock.teamid = @teamid
+WHERE chunk.filehash = ANY(@filehashes::text[])
+ORDER BY chunk.filehash, chunk.chunkindex ASC;
+
+-- only registers chunks whose block is already stored
+-- name: RegisterChunks :execrows
+INSERT INTO chunk(chunkindex, numchunks, filehash, blockhash, blocksize)
+SELECT c.chunkindex, c.numchunks, c.filehash, b.blockhash, b.blocksize
+FROM unnest(@chunkindexes::int[], @numchunks::int[], @filehashes::text[], @blockhashes::text[])
+AS c(chunkindex, numchunks, filehash, blockhash)
+INNER JOIN block b ON b.blockhash = c.blockhash
+ON CONFLICT(filehash, chunkindex) DO NOTHING;
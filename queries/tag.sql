@@ -0,0 +1,20 @@
+-- name: InsertTag :one
+INSERT INTO tag(projectid, name, commitid, message, userid)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING tagid;
+
+-- name: ListProjectTags :many
+SELECT tag.name, tag.message, tag.userid, tag.timestamp, tag.commitid, commit.cno FROM tag
+INNER JOIN commit ON commit.commitid = tag.commitid
+WHERE tag.projectid = $1
+ORDER BY tag.tagid DESC;
+
+-- name: GetTagCommit :one
+SELECT tag.commitid, commit.cno FROM tag
+INNER JOIN commit ON commit.commitid = tag.commitid
+WHERE tag.projectid = $1 AND tag.name = $2;
+
+-- name: DeleteTag :one
+DELETE FROM tag
+WHERE projectid = $1 AND name = $2
+RETURNING commitid;
@@ -0,0 +1,22 @@
+-- name: InsertLocalUser :exec
+INSERT INTO localuser(userid, email, name, passwordhash) VALUES($1, $2, $3, $4);
+
+-- name: GetLocalUser :one
+SELECT userid, email, name FROM localuser
+WHERE userid = $1;
+
+-- name: GetLocalUsers :many
+SELECT userid, email, name FROM localuser
+WHERE userid = ANY(@userids::text[]);
+
+-- name: GetLocalUserByEmail :one
+SELECT * FROM localuser
+WHERE email = $1;
+
+-- name: ListLocalUsers :many
+SELECT userid, email, name FROM localuser
+ORDER BY name;
+
+-- name: SetLocalUserPassword :execrows
+UPDATE localuser SET passwordhash = $2
+WHERE email = $1;
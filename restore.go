@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+)
+
+// a filerevision that needs to be written to get a path back to a previous state
+type RestoreChange struct {
+	Path       string `json:"path"`
+	FileHash   string `json:"hash"`
+	ChangeType int    `json:"changetype"`
+	NumChunks  int32  `json:"-"`
+}
+
+// returns the latest revision of each path as of commitId, keyed by path
+func getRevisionsAtCommit(ctx context.Context, q *sqlcgen.Queries, projectId int, commitId int32) (map[string]sqlcgen.GetLatestRevisionsAtCommitRow, error) {
+	rows, err := q.GetLatestRevisionsAtCommit(ctx, sqlcgen.GetLatestRevisionsAtCommitParams{
+		Projectid: int32(projectId),
+		Commitid:  commitId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	revisions := make(map[string]sqlcgen.GetLatestRevisionsAtCommitRow, len(rows))
+	for _, row := range rows {
+		revisions[row.Path] = row
+	}
+	return revisions, nil
+}
+
+// computes the changes that take the project from current to target:
+// - paths that exist in target but are missing/deleted now get created
+// - paths that exist in both but with a different hash get modified
+// - paths that exist now but not in target get deleted
+// changes are sorted by path. deletes keep the hash the path had and no chunks,
+// like the deletes in a regular commit
+func diffRevisions(current map[string]sqlcgen.GetLatestRevisionsAtCommitRow, target map[string]sqlcgen.GetLatestRevisionsAtCommitRow) []RestoreChange {
+	changes := make([]RestoreChange, 0)
+	for path, want := range target {
+		if want.Changetype == ChangeTypeDelete {
+			continue
+		}
+		have, ok := current[path]
+		if !ok || have.Changetype == ChangeTypeDelete {
+			changes = append(changes, RestoreChange{Path: path, FileHash: want.Filehash, ChangeType: ChangeTypeCreate, NumChunks: want.Numchunks})
+		} else if have.Filehash != want.Filehash {
+			changes = append(changes, RestoreChange{Path: path, FileHash: want.Filehash, ChangeType: ChangeTypeModify, NumChunks: want.Numchunks})
+		}
+	}
+	for path, have := range current {
+		if have.Changetype == ChangeTypeDelete {
+			continue
+		}
+		want, ok := target[path]
+		if !ok || want.Changetype == ChangeTypeDelete {
+			changes = append(changes, RestoreChange{Path: path, FileHash: have.Filehash, ChangeType: ChangeTypeDelete})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// writes the changes as filerevisions of commitId
+func insertRestoreChanges(ctx context.Context, q *sqlcgen.Queries, projectId int, commitId int32, changes []RestoreChange) error {
+	for _, change := range changes {
+		err := q.InsertFileRevision(ctx, sqlcgen.InsertFileRevisionParams{
+			Projectid:  int32(projectId),
+			Path:       change.Path,
+			Commitid:   commitId,
+			Filehash:   change.FileHash,
+			Numchunks:  change.NumChunks,
+			Changetype: int32(change.ChangeType)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// records a privileged action; detail is stored as json
+func writeAuditLog(ctx context.Context, q *sqlcgen.Queries, projectId int, userId string, action string, detail any) error {
+	detail_bytes, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	return q.InsertAuditLog(ctx, sqlcgen.InsertAuditLogParams{
+		Projectid: int32(projectId),
+		Userid:    userId,
+		Action:    action,
+		Detail:    string(detail_bytes),
+	})
+}
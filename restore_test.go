@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+)
+
+func TestDiffRevisions(t *testing.T) {
+	type revisions = map[string]sqlcgen.GetLatestRevisionsAtCommitRow
+	rev := func(hash string, changetype int32) sqlcgen.GetLatestRevisionsAtCommitRow {
+		return sqlcgen.GetLatestRevisionsAtCommitRow{Filehash: hash, Changetype: changetype, Numchunks: 1}
+	}
+
+	tests := []struct {
+		name    string
+		current revisions
+		target  revisions
+		want    []RestoreChange
+	}{
+		{"nothing", revisions{}, revisions{}, []RestoreChange{}},
+		{
+			"unchanged",
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			revisions{"a": rev("1", ChangeTypeModify)},
+			[]RestoreChange{},
+		},
+		{
+			"missing now",
+			revisions{},
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			[]RestoreChange{{Path: "a", FileHash: "1", ChangeType: ChangeTypeCreate, NumChunks: 1}},
+		},
+		{
+			"deleted now",
+			revisions{"a": rev("2", ChangeTypeDelete)},
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			[]RestoreChange{{Path: "a", FileHash: "1", ChangeType: ChangeTypeCreate, NumChunks: 1}},
+		},
+		{
+			"modified",
+			revisions{"a": rev("2", ChangeTypeModify)},
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			[]RestoreChange{{Path: "a", FileHash: "1", ChangeType: ChangeTypeModify, NumChunks: 1}},
+		},
+		{
+			"not in target",
+			revisions{"a": rev("1", ChangeTypeCreate)},
+			revisions{},
+			[]RestoreChange{{Path: "a", FileHash: "1", ChangeType: ChangeTypeDelete}},
+		},
+		{
+			"deleted in target",
+			revisions{"a": rev("2", ChangeTypeModify)},
+			revisions{"a": rev("1", ChangeTypeDelete)},
+			[]RestoreChange{{Path: "a", FileHash: "2", ChangeType: ChangeTypeDelete}},
+		},
+		{
+			"deleted in both",
+			revisions{"a": rev("2", ChangeTypeDelete)},
+			revisions{"a": rev("1", ChangeTypeDelete)},
+			[]RestoreChange{},
+		},
+		{
+			"sorted by path",
+			revisions{"c": rev("3", ChangeTypeCreate), "b": rev("2", ChangeTypeCreate)},
+			revisions{"a": rev("1", ChangeTypeCreate), "b": rev("1", ChangeTypeCreate)},
+			[]RestoreChange{
+				{Path: "a", FileHash: "1", ChangeType: ChangeTypeCreate, NumChunks: 1},
+				{Path: "b", FileHash: "1", ChangeType: ChangeTypeModify, NumChunks: 1},
+				{Path: "c", FileHash: "3", ChangeType: ChangeTypeDelete},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := diffRevisions(test.current, test.target); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("diffRevisions() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -7,43 +7,36 @@ import (
 	"errors"
 	"io"
 	"net/http"
-	"net/url"
-	"os"
 	"strconv"
 	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
 	"github.com/joshtenorio/glassypdm-server/internal/dal"
 	"github.com/joshtenorio/glassypdm-server/internal/observer"
+	"github.com/joshtenorio/glassypdm-server/internal/project"
 	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/joshtenorio/glassypdm-server/internal/store"
 	"github.com/posthog/posthog-go"
 	"lukechampine.com/blake3"
 )
 
-func generateS3Client() (*minio.Client, error) {
-	endpoint := os.Getenv("S3_ENDPOINT")
-	accessKeyID := os.Getenv("S3_ACCESSKEYID")
-	secretAccessKey := os.Getenv("S3_SECRETKEY")
-	useSSL := true
-
-	return minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
-		Secure: useSSL,
-	})
-}
-
 /*
 steps:
-- check permission for uploading in general
-- reads file, upload to s3
-- compares user-supplied hash w/ our own hashing. if they match, we put thing in db. otherwise we delete from s3
+- check permission for uploading to the project
+- reads file and compares user-supplied hash w/ our own hashing, rejecting it if they don't match
+- uploads to the blob store unless we have the block already, then puts thing in db
 */
 func HandleUpload(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
+	UserId, scope, ok := getStoreCaller(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
 
 	// note: this size here is just for parsing and not the actual size limit of the file
 	// TODO is this note correct?
@@ -52,8 +45,8 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	UserId := r.FormValue("user_id")
-	if UserId == "" {
+	ProjectId, err := strconv.Atoi(r.FormValue("project_id"))
+	if err != nil {
 		WriteCustomError(w, "form format incorrect")
 		return
 	}
@@ -100,8 +93,8 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ensure user can upload to at least one project/team
-	if !canUserUpload(UserId) {
+	// ensure user can write to the project
+	if !canUseStore(UserId, scope, ProjectId, false) {
 		WriteCustomError(w, "no upload permission")
 		observer.PostHogClient.Enqueue(posthog.Capture{
 			DistinctId: UserId,
@@ -111,33 +104,46 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// set position back to start.
-	if _, err := file.Seek(0, 0); err != nil {
+	// hash the chunk before anything is linked, so the block only gets
+	// added to the team if the caller really has it
+	hasher := blake3.New(32, nil)
+	if _, err := io.Copy(hasher, file); err != nil {
 		WriteCustomError(w, "error reading file")
 		log.Error("couldn't read file", "err", err.Error())
+		return
+	}
+	hashCalc := hasher.Sum(nil)
+	if hashUser != hex.EncodeToString(hashCalc) {
+		log.Error("hash doesn't match", "user", hashUser, "calculated", hashCalc)
+		WriteCustomError(w, "hash doesn't match")
 		observer.PostHogClient.Enqueue(posthog.Capture{
 			DistinctId: UserId,
 			Event:      "chunk-upload-failed",
-			Properties: posthog.NewProperties().Set("failure-type", "setting position to 0"),
+			Properties: posthog.NewProperties().Set("failure-type", "hash doesn't match"),
 		})
 		return
 	}
 
-	s3, err := generateS3Client()
+	teamId, err := dal.Queries.GetTeamByProject(ctx, int32(ProjectId))
 	if err != nil {
-		log.Error("couldn't connect to s3", "err", err.Error())
+		log.Error("couldn't get team", "project", ProjectId, "db", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	// set position back to start.
+	if _, err := file.Seek(0, 0); err != nil {
+		WriteCustomError(w, "error reading file")
+		log.Error("couldn't read file", "err", err.Error())
 		observer.PostHogClient.Enqueue(posthog.Capture{
 			DistinctId: UserId,
 			Event:      "chunk-upload-failed",
-			Properties: posthog.NewProperties().Set("failure-type", "s3 connection failed"),
+			Properties: posthog.NewProperties().Set("failure-type", "setting position to 0"),
 		})
-		WriteCustomError(w, "issue connecting to s3")
 		return
 	}
-	hasher := blake3.New(32, nil)
-	tee := io.TeeReader(file, hasher)
 
-	// check if object exists in S3 already
+	// check if object exists in the blob store already
 	err = dal.Queries.InsertHash(ctx,
 		sqlcgen.InsertHashParams{Blockhash: hashUser, S3key: hashUser, Blocksize: int32(size)})
 	if err != nil {
@@ -151,6 +157,14 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 				Properties: posthog.NewProperties().Set("warning-type", "db unique violation (hash already exists in db)"),
 			})
 
+			// the content matched, so the team has the block now too
+			err = dal.Queries.InsertTeamBlock(ctx, sqlcgen.InsertTeamBlockParams{Teamid: teamId, Blockhash: hashUser})
+			if err != nil {
+				log.Error("couldn't insert team block", "db", err.Error())
+				WriteCustomError(w, "db error")
+				return
+			}
+
 			// insert the chunk because we need to anyways
 			err = dal.Queries.InsertChunk(ctx, sqlcgen.InsertChunkParams{
 				Chunkindex: int32(cidx),
@@ -185,44 +199,24 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// insert object into S3
-	_, err = s3.PutObject(
-		ctx,
-		os.Getenv("S3_BUCKETNAME"),
-		hashUser,
-		tee,
-		size,
-		minio.PutObjectOptions{ContentType: "application/octet-stream"})
-
+	// insert object into the blob store
+	err = store.Blobs.Put(ctx, hashUser, file, size)
 	if err != nil {
 		observer.PostHogClient.Enqueue(posthog.Capture{
 			DistinctId: UserId,
 			Event:      "chunk-upload-failed",
 			Properties: posthog.NewProperties().Set("failure-type", "s3 upload failed"),
 		})
-		log.Error("couldn't upload to s3", "s3", err.Error())
+		log.Error("couldn't upload to blob store", "store", err.Error())
 		WriteCustomError(w, "issue connecting to s3")
+		dal.Queries.RemoveHash(ctx, hashUser)
 		return
 	}
 
-	// confirm hash matches what the user supplies us
-	// if hash does not match, remove from bucket and db
-	hashCalc := hasher.Sum(nil)
-	if hashUser != hex.EncodeToString(hashCalc) {
-		log.Error("hash doesn't match", "user", hashUser, "calculated", hashCalc)
-		WriteCustomError(w, "hash doesn't match")
-		s3.RemoveObject(
-			ctx,
-			os.Getenv("S3_BUCKETNAME"),
-			hashUser,
-			minio.RemoveObjectOptions{})
-
-		dal.Queries.RemoveHash(ctx, hashUser)
-		observer.PostHogClient.Enqueue(posthog.Capture{
-			DistinctId: UserId,
-			Event:      "chunk-upload-failed",
-			Properties: posthog.NewProperties().Set("failure-type", "hash doesn't match"),
-		})
+	err = dal.Queries.InsertTeamBlock(ctx, sqlcgen.InsertTeamBlockParams{Teamid: teamId, Blockhash: hashUser})
+	if err != nil {
+		log.Error("couldn't insert team block", "db", err.Error())
+		WriteCustomError(w, "db error")
 		return
 	}
 
@@ -261,6 +255,41 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 	WriteDefaultSuccess(w, "upload successful")
 }
 
+// returns who is calling a store route, along with the store token claims
+// if the request was authenticated with a store token instead of a session
+func getStoreCaller(r *http.Request) (string, *project.StoreClaims, bool) {
+	if scope, ok := project.StoreClaimsFromContext(r.Context()); ok {
+		return scope.UserID, &scope, true
+	}
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		return "", nil, false
+	}
+	return claims.Subject, nil, true
+}
+
+// checks the caller can upload to/download from the project.
+// store tokens only work for the project and action they were issued for
+func canUseStore(userId string, scope *project.StoreClaims, projectId int, isDownload bool) bool {
+	if !storeScopeAllows(scope, projectId, isDownload) {
+		return false
+	}
+	return storeLevelAllows(GetProjectPermissionByID(userId, projectId), isDownload)
+}
+
+// whether the store token covers the project and action, a session has no scope so it always does
+func storeScopeAllows(scope *project.StoreClaims, projectId int, isDownload bool) bool {
+	return scope == nil || (scope.ProjectID == projectId && scope.IsDownload() == isDownload)
+}
+
+// downloading needs read access to the project, uploading needs write access
+func storeLevelAllows(level int, isDownload bool) bool {
+	if isDownload {
+		return level >= ProjectLevelRead
+	}
+	return level >= ProjectLevelWrite
+}
+
 type FileChunk struct {
 	Url       string `json:"s3_url"`
 	BlockHash string `json:"block_hash"`
@@ -278,11 +307,17 @@ type DownloadRequest struct {
 	ProjectId int    `json:"project_id"`
 	Path      string `json:"path"`
 	CommitId  int    `json:"commit_id"`
-	UserId    string `json:"user_id"`
+	Tag       string `json:"tag,omitempty"` // download the file as of a tag instead of commit_id
 }
 
 func GetS3Download(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
+	userId, scope, ok := getStoreCaller(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
 
 	var request DownloadRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -292,32 +327,46 @@ func GetS3Download(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check permission level
-	if GetProjectPermissionByID(request.UserId, request.ProjectId) < 1 {
+	if !canUseStore(userId, scope, request.ProjectId, true) {
 		WriteCustomError(w, "no permission")
 		return
 	}
 
-	s3, err := generateS3Client()
-	if err != nil {
-		log.Error("couldn't connect to s3", "s3", err.Error())
-		WriteCustomError(w, "issue connecting to s3")
-		return
-	}
-
 	// get filehash from filepath+projectid
-	filehash, err := dal.Queries.GetFileHash(ctx,
-		sqlcgen.GetFileHashParams{
+	var filehash string
+	if request.Tag != "" {
+		commitId, _, err := resolveCommitRef(ctx, request.ProjectId, request.Tag)
+		if err != nil {
+			log.Warn("couldn't find tag", "projectID", request.ProjectId, "tag", request.Tag)
+			WriteCustomError(w, "invalid commit")
+			return
+		}
+		revision, err := dal.Queries.GetFileRevisionAtCommit(ctx, sqlcgen.GetFileRevisionAtCommitParams{
 			Projectid: int32(request.ProjectId),
 			Path:      request.Path,
-			Commitid:  int32(request.CommitId),
+			Commitid:  commitId,
 		})
-	if err != nil {
-		log.Error("couldn't get filehash", "projectID", request.ProjectId, "filepath", request.Path, "db err", err.Error())
-		WriteCustomError(w, "db error")
-		return
+		if err != nil || revision.Changetype == ChangeTypeDelete {
+			log.Warn("file doesn't exist at tag", "projectID", request.ProjectId, "filepath", request.Path, "tag", request.Tag)
+			WriteCustomError(w, "file not found")
+			return
+		}
+		filehash = revision.Filehash
+	} else {
+		filehash, err = dal.Queries.GetFileHash(ctx,
+			sqlcgen.GetFileHashParams{
+				Projectid: int32(request.ProjectId),
+				Path:      request.Path,
+				Commitid:  int32(request.CommitId),
+			})
+		if err != nil {
+			log.Error("couldn't get filehash", "projectID", request.ProjectId, "filepath", request.Path, "db err", err.Error())
+			WriteCustomError(w, "db error")
+			return
+		}
 	}
 
-	// ping s3 for a presigned url
+	// get the blocks that make up the file
 	chunksDto, err := dal.Queries.GetFileChunks(ctx, filehash)
 	if err != nil {
 		log.Error("coudln't get file chunks", "filehash", filehash, "db err", err.Error())
@@ -327,17 +376,16 @@ func GetS3Download(w http.ResponseWriter, r *http.Request) {
 
 	var chunks []FileChunk
 	for _, chunk := range chunksDto {
-		// ping s3 for a presigned url
-		reqParams := make(url.Values)
-		url, err := s3.PresignedGetObject(ctx, os.Getenv("S3_BUCKETNAME"), chunk.Blockhash, time.Second*60*60*48, reqParams)
+		// ping the blob store for a presigned url
+		url, err := store.Blobs.PresignGet(ctx, chunk.Blockhash, time.Second*60*60*48)
 		if err != nil {
-			log.Error("couldn't get presigned GET link", "s3", err.Error())
+			log.Error("couldn't get presigned GET link", "store", err.Error())
 			WriteCustomError(w, "s3 error")
 			return
 		}
 		chunks = append(chunks,
 			FileChunk{
-				Url:       url.String(),
+				Url:       url,
 				BlockHash: chunk.Blockhash,
 				Index:     int(chunk.Chunkindex),
 				FileHash:  filehash})
@@ -354,3 +402,417 @@ func GetS3Download(w http.ResponseWriter, r *http.Request) {
 	output_str, _ := json.Marshal(output)
 	WriteSuccess(w, string(output_str))
 }
+
+type NegotiateChunk struct {
+	Index     int    `json:"chunk_index"`
+	BlockHash string `json:"block_hash"`
+}
+
+type NegotiateFile struct {
+	FileHash  string           `json:"file_hash"`
+	NumChunks int              `json:"num_chunks"`
+	Chunks    []NegotiateChunk `json:"chunks"`
+}
+
+type NegotiateRequest struct {
+	ProjectId int             `json:"project_id"`
+	Files     []NegotiateFile `json:"files"`
+}
+
+type NegotiateOutput struct {
+	MissingBlocks    []string `json:"missing_blocks"`    // blocks the client still needs to upload
+	IncompleteFiles  []string `json:"incomplete_files"`  // files that are missing at least one chunk
+	ChunksRegistered int      `json:"chunks_registered"` // chunks mapped to blocks we already had
+}
+
+/*
+lets the client skip uploading blocks the team already has:
+- finds which of the requested blocks are already stored for the team
+- maps the chunks for those blocks to their files
+- returns the blocks that still need to be uploaded
+*/
+func NegotiateUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	userId, scope, ok := getStoreCaller(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+
+	var request NegotiateRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+	// ensure user can write to the project
+	if !canUseStore(userId, scope, request.ProjectId, false) {
+		WriteCustomError(w, "no upload permission")
+		return
+	}
+
+	blockHashes, ok := validateNegotiateFiles(request.Files)
+	if !ok {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	teamId, err := dal.Queries.GetTeamByProject(ctx, int32(request.ProjectId))
+	if err != nil {
+		log.Error("couldn't get team", "project", request.ProjectId, "db", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	// blocks only stored for other teams count as missing, the client has to upload them
+	stored, _, err := findStoredBlocks(ctx, teamId, blockHashes)
+	if err != nil {
+		log.Error("couldn't look up existing blocks", "db", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	output, err := registerFileChunks(ctx, teamId, request.Files, stored)
+	if err != nil {
+		log.Error("couldn't register chunks", "db", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	observer.PostHogClient.Enqueue(posthog.Capture{
+		DistinctId: userId,
+		Event:      "upload-negotiated",
+		Properties: posthog.NewProperties().
+			Set("blocks-requested", len(blockHashes)).
+			Set("blocks-missing", len(output.MissingBlocks)),
+	})
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+// checks that every file has a hash and its chunk indexes are in range,
+// and returns all of the block hashes referenced
+func validateNegotiateFiles(files []NegotiateFile) ([]string, bool) {
+	var blockHashes []string
+	for _, file := range files {
+		if file.FileHash == "" || file.NumChunks < 1 {
+			return nil, false
+		}
+		for _, chunk := range file.Chunks {
+			if chunk.BlockHash == "" || chunk.Index < 0 || chunk.Index >= file.NumChunks {
+				return nil, false
+			}
+			blockHashes = append(blockHashes, chunk.BlockHash)
+		}
+	}
+	return blockHashes, true
+}
+
+// finds which blocks are stored for the team, and which are only stored for other teams.
+// a team can only reuse its own blocks, anything else has to be uploaded again
+// so we know the team really has it
+func findStoredBlocks(ctx context.Context, teamId int32, blockHashes []string) (map[string]bool, map[string]bool, error) {
+	teamBlocks, err := dal.Queries.FindTeamBlocks(ctx, sqlcgen.FindTeamBlocksParams{Teamid: teamId, Blockhashes: blockHashes})
+	if err != nil {
+		return nil, nil, err
+	}
+	stored := make(map[string]bool, len(teamBlocks))
+	for _, hash := range teamBlocks {
+		stored[hash] = true
+	}
+
+	existing, err := dal.Queries.FindExistingBlocks(ctx, blockHashes)
+	if err != nil {
+		return nil, nil, err
+	}
+	foreign := make(map[string]bool)
+	for _, hash := range existing {
+		if !stored[hash] {
+			foreign[hash] = true
+		}
+	}
+	return stored, foreign, nil
+}
+
+// where a team uploads its copy of a block that's already stored for another team.
+// finalize checks the copy against the hash before the team gets the block, then removes it
+func stagingKey(blockHash string, teamId int32) string {
+	return blockHash + "_team" + strconv.Itoa(int(teamId))
+}
+
+// maps chunks onto blocks the team has, then reports the blocks
+// that are still missing and the files that aren't complete yet
+func registerFileChunks(ctx context.Context, teamId int32, files []NegotiateFile, stored map[string]bool) (NegotiateOutput, error) {
+	output := NegotiateOutput{MissingBlocks: make([]string, 0), IncompleteFiles: make([]string, 0)}
+
+	var params sqlcgen.RegisterChunksParams
+	var fileHashes []string
+	missing := make(map[string]bool)
+	for _, file := range files {
+		fileHashes = append(fileHashes, file.FileHash)
+		for _, chunk := range file.Chunks {
+			if !stored[chunk.BlockHash] {
+				if !missing[chunk.BlockHash] {
+					missing[chunk.BlockHash] = true
+					output.MissingBlocks = append(output.MissingBlocks, chunk.BlockHash)
+				}
+				continue
+			}
+			params.Chunkindexes = append(params.Chunkindexes, int32(chunk.Index))
+			params.Numchunks = append(params.Numchunks, int32(file.NumChunks))
+			params.Filehashes = append(params.Filehashes, file.FileHash)
+			params.Blockhashes = append(params.Blockhashes, chunk.BlockHash)
+		}
+	}
+	registered, err := dal.Queries.RegisterChunks(ctx, params)
+	if err != nil {
+		return output, err
+	}
+	output.ChunksRegistered = int(registered)
+
+	indexes, err := dal.Queries.ListFileChunkIndexes(ctx, sqlcgen.ListFileChunkIndexesParams{Teamid: teamId, Filehashes: fileHashes})
+	if err != nil {
+		return output, err
+	}
+	chunkCount := make(map[string]int)
+	for _, index := range indexes {
+		chunkCount[index.Filehash]++
+	}
+	for _, file := range files {
+		if chunkCount[file.FileHash] < file.NumChunks {
+			output.IncompleteFiles = append(output.IncompleteFiles, file.FileHash)
+		}
+	}
+	return output, nil
+}
+
+type PresignUploadRequest struct {
+	ProjectId   int      `json:"project_id"`
+	BlockHashes []string `json:"block_hashes"`
+}
+
+type PresignedBlock struct {
+	BlockHash string            `json:"block_hash"`
+	Url       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"` // send these with the PUT or it's rejected
+}
+
+type PresignUploadOutput struct {
+	Blocks []PresignedBlock `json:"blocks"`
+	Stored []string         `json:"stored"` // blocks the team already has, no upload needed
+}
+
+// hands out presigned PUT urls so blocks go straight to the blob store
+// without passing through this server. call /store/upload/finalize after uploading.
+// a PUT to a block that's already in the store is rejected (409 locally, 412 on s3),
+// the block is there already so the client can go on to finalize.
+// blocks that are only stored for other teams get a url for a separate copy,
+// which finalize checks and removes once the team has the block
+func PresignUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	userId, scope, ok := getStoreCaller(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+
+	var request PresignUploadRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+	// ensure user can write to the project
+	if !canUseStore(userId, scope, request.ProjectId, false) {
+		WriteCustomError(w, "no upload permission")
+		return
+	}
+
+	teamId, err := dal.Queries.GetTeamByProject(ctx, int32(request.ProjectId))
+	if err != nil {
+		log.Error("couldn't get team", "project", request.ProjectId, "db", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	stored, foreign, err := findStoredBlocks(ctx, teamId, request.BlockHashes)
+	if err != nil {
+		log.Error("couldn't look up existing blocks", "db", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	output := PresignUploadOutput{Blocks: make([]PresignedBlock, 0), Stored: make([]string, 0)}
+	for _, hash := range request.BlockHashes {
+		if stored[hash] {
+			output.Stored = append(output.Stored, hash)
+			continue
+		}
+		key := hash
+		if foreign[hash] {
+			key = stagingKey(hash, teamId)
+		}
+		url, headers, err := store.Blobs.PresignPut(ctx, key, time.Second*60*60)
+		if err != nil {
+			log.Error("couldn't get presigned PUT link", "store", err.Error())
+			WriteCustomError(w, "s3 error")
+			return
+		}
+		block := PresignedBlock{BlockHash: hash, Url: url}
+		if len(headers) > 0 {
+			block.Headers = make(map[string]string, len(headers))
+			for name := range headers {
+				block.Headers[name] = headers.Get(name)
+			}
+		}
+		output.Blocks = append(output.Blocks, block)
+	}
+
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+type FinalizeUploadOutput struct {
+	NegotiateOutput
+	CorruptBlocks []string `json:"corrupt_blocks"` // uploaded but the hash didn't match, so they were removed
+}
+
+/*
+steps:
+- for every block the team doesn't have yet, read it back from the blob store and hash it
+- blocks that are stored for another team are read from the team's copy instead
+- blocks that match get inserted and added to the team, blocks that don't are deleted from the blob store
+- chunks are mapped onto the verified blocks
+*/
+func FinalizeUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	userId, scope, ok := getStoreCaller(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+
+	var request NegotiateRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+	// ensure user can write to the project
+	if !canUseStore(userId, scope, request.ProjectId, false) {
+		WriteCustomError(w, "no upload permission")
+		return
+	}
+
+	blockHashes, ok := validateNegotiateFiles(request.Files)
+	if !ok {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+
+	teamId, err := dal.Queries.GetTeamByProject(ctx, int32(request.ProjectId))
+	if err != nil {
+		log.Error("couldn't get team", "project", request.ProjectId, "db", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	stored, foreign, err := findStoredBlocks(ctx, teamId, blockHashes)
+	if err != nil {
+		log.Error("couldn't look up existing blocks", "db", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	corrupt := make([]string, 0)
+	for _, hash := range blockHashes {
+		if _, seen := stored[hash]; seen {
+			continue
+		}
+		key := hash
+		if foreign[hash] {
+			key = stagingKey(hash, teamId)
+		}
+		valid, size, err := verifyStoredBlock(ctx, key, hash)
+		if err == store.ErrNotFound {
+			// never uploaded, will be reported as missing
+			stored[hash] = false
+			continue
+		} else if err != nil {
+			log.Error("couldn't read block back from blob store", "block", hash, "store", err.Error())
+			WriteCustomError(w, "s3 error")
+			return
+		}
+
+		if !valid {
+			log.Error("hash doesn't match", "block", hash)
+			store.Blobs.Delete(ctx, key)
+			corrupt = append(corrupt, hash)
+			stored[hash] = false
+			observer.PostHogClient.Enqueue(posthog.Capture{
+				DistinctId: userId,
+				Event:      "chunk-upload-failed",
+				Properties: posthog.NewProperties().Set("failure-type", "hash doesn't match"),
+			})
+			continue
+		}
+
+		if !foreign[hash] {
+			err = dal.Queries.InsertHash(ctx,
+				sqlcgen.InsertHashParams{Blockhash: hash, S3key: hash, Blocksize: int32(size)})
+			var e *pgconn.PgError
+			if err != nil && !(errors.As(err, &e) && e.Code == pgerrcode.UniqueViolation) {
+				log.Error("couldn't insert hash", "db", err.Error())
+				WriteCustomError(w, "db error")
+				return
+			}
+		}
+		err = dal.Queries.InsertTeamBlock(ctx, sqlcgen.InsertTeamBlockParams{Teamid: teamId, Blockhash: hash})
+		if err != nil {
+			log.Error("couldn't insert team block", "db", err.Error())
+			WriteCustomError(w, "db error")
+			return
+		}
+		if foreign[hash] {
+			// the block itself is stored already, the copy was only proof
+			store.Blobs.Delete(ctx, key)
+		}
+		stored[hash] = true
+	}
+
+	negotiated, err := registerFileChunks(ctx, teamId, request.Files, stored)
+	if err != nil {
+		log.Error("couldn't register chunks", "db", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	output := FinalizeUploadOutput{NegotiateOutput: negotiated, CorruptBlocks: corrupt}
+	observer.PostHogClient.Enqueue(posthog.Capture{
+		DistinctId: userId,
+		Event:      "upload-finalized",
+		Properties: posthog.NewProperties().
+			Set("chunks-registered", output.ChunksRegistered).
+			Set("blocks-corrupt", len(corrupt)),
+	})
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+// reads a block back from the blob store and checks it against its hash
+func verifyStoredBlock(ctx context.Context, key string, blockHash string) (bool, int64, error) {
+	blob, err := store.Blobs.Get(ctx, key)
+	if err != nil {
+		return false, 0, err
+	}
+	defer blob.Close()
+
+	hasher := blake3.New(32, nil)
+	size, err := io.Copy(hasher, blob)
+	if err != nil {
+		return false, 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)) == blockHash, size, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/joshtenorio/glassypdm-server/internal/project"
+)
+
+func TestStoreAccess(t *testing.T) {
+	upload := &project.StoreClaims{UserID: "user", ProjectID: 1, Action: project.StoreActionUpload}
+	download := &project.StoreClaims{UserID: "user", ProjectID: 1, Action: project.StoreActionDownload}
+
+	tests := []struct {
+		name       string
+		scope      *project.StoreClaims
+		projectId  int
+		isDownload bool
+		level      int
+		want       bool
+	}{
+		{"session download", nil, 1, true, ProjectLevelRead, true},
+		{"session download no access", nil, 1, true, ProjectLevelNone, false},
+		{"session upload", nil, 1, false, ProjectLevelWrite, true},
+		{"session upload read only", nil, 1, false, ProjectLevelRead, false},
+		{"session upload manager", nil, 1, false, ProjectLevelManage, true},
+		{"download token", download, 1, true, ProjectLevelRead, true},
+		{"download token no access", download, 1, true, ProjectLevelNone, false},
+		{"download token for upload", download, 1, false, ProjectLevelManage, false},
+		{"download token other project", download, 2, true, ProjectLevelManage, false},
+		{"upload token", upload, 1, false, ProjectLevelWrite, true},
+		{"upload token read only", upload, 1, false, ProjectLevelRead, false},
+		{"upload token for download", upload, 1, true, ProjectLevelManage, false},
+		{"upload token other project", upload, 2, false, ProjectLevelManage, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := storeScopeAllows(test.scope, test.projectId, test.isDownload) && storeLevelAllows(test.level, test.isDownload)
+			if got != test.want {
+				t.Errorf("store access = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
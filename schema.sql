@@ -37,7 +37,7 @@ CREATE TABLE IF NOT EXISTS pgmembership(
 CREATE TABLE IF NOT EXISTS pgmapping(
     pgroupid INTEGER NOT NULL,
     projectid INTEGER NOT NULL,
-    level INTEGER NOT NULL DEFAULT 0,
+    level INTEGER NOT NULL DEFAULT 2,
     PRIMARY KEY (pgroupid, projectid),
     FOREIGN KEY(pgroupid) REFERENCES permissiongroup(pgroupid),
     FOREIGN KEY(projectid) REFERENCES project(projectid)
@@ -96,6 +96,95 @@ CREATE TABLE IF NOT EXISTS chunk(
     UNIQUE(filehash, chunkindex)
 );
 
+-- record of destructive or privileged actions, e.g. project restores
+CREATE TABLE IF NOT EXISTS auditlog(
+    auditid SERIAL PRIMARY KEY NOT NULL,
+    projectid INTEGER NOT NULL,
+    userid TEXT NOT NULL,
+    action TEXT NOT NULL,
+    detail TEXT NOT NULL,
+    timestamp TIMESTAMP DEFAULT NOW() NOT NULL,
+    FOREIGN KEY(projectid) REFERENCES project(projectid)
+);
+
+-- named commits, e.g. releases. tags can be deleted but not moved
+CREATE TABLE IF NOT EXISTS tag(
+    tagid SERIAL PRIMARY KEY NOT NULL,
+    projectid INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    commitid INTEGER NOT NULL,
+    message TEXT NOT NULL,
+    userid TEXT NOT NULL,
+    timestamp TIMESTAMP DEFAULT NOW() NOT NULL,
+    FOREIGN KEY(projectid) REFERENCES project(projectid),
+    FOREIGN KEY(commitid) REFERENCES commit(commitid),
+    UNIQUE(projectid, name)
+);
+
+/*
+lines of work that split off from a commit on main. branch 0 is main and has no row here.
+basecommit is the main commit the branch builds on, promoted is the branch's last
+commit that has been promoted onto main (0 if none)
+*/
+CREATE TABLE IF NOT EXISTS branch(
+    branchid SERIAL PRIMARY KEY NOT NULL,
+    projectid INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    basecommit INTEGER NOT NULL,
+    promoted INTEGER NOT NULL DEFAULT 0,
+    userid TEXT NOT NULL,
+    timestamp TIMESTAMP DEFAULT NOW() NOT NULL,
+    FOREIGN KEY(projectid) REFERENCES project(projectid),
+    FOREIGN KEY(basecommit) REFERENCES commit(commitid),
+    UNIQUE(projectid, name)
+);
+
+/*
+invitations to join a team, for people who may not have an account yet.
+only a hash of the token is kept, userid is who sent the invite and
+acceptedby is the account it was bound to when it was accepted
+*/
+CREATE TABLE IF NOT EXISTS invite(
+    inviteid SERIAL PRIMARY KEY NOT NULL,
+    teamid INTEGER NOT NULL,
+    email TEXT NOT NULL,
+    level INTEGER NOT NULL,
+    tokenhash TEXT NOT NULL UNIQUE,
+    userid TEXT NOT NULL,
+    timestamp TIMESTAMP DEFAULT NOW() NOT NULL,
+    expires TIMESTAMP NOT NULL,
+    acceptedby TEXT,
+    acceptedat TIMESTAMP,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY(teamid) REFERENCES team(teamid)
+);
+
+-- accounts for AUTH_PROVIDER=local, unused with Clerk
+CREATE TABLE IF NOT EXISTS localuser(
+    userid TEXT PRIMARY KEY NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    passwordhash TEXT NOT NULL,
+    timestamp TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+-- used by garbage collection so in-flight uploads aren't swept
+ALTER TABLE block ADD COLUMN IF NOT EXISTS created TIMESTAMP DEFAULT NOW() NOT NULL;
+ALTER TABLE chunk ADD COLUMN IF NOT EXISTS created TIMESTAMP DEFAULT NOW() NOT NULL;
+
+/*
+blocks a team has uploaded itself. blocks are shared between teams in the blob store,
+but a team's files can only use blocks it has shown it has, so knowing a block's hash
+isn't enough to get at another team's data
+*/
+CREATE TABLE IF NOT EXISTS teamblock(
+    teamid INTEGER NOT NULL,
+    blockhash TEXT NOT NULL,
+    PRIMARY KEY(teamid, blockhash),
+    FOREIGN KEY(teamid) REFERENCES team(teamid),
+    FOREIGN KEY(blockhash) REFERENCES block(blockhash) ON DELETE CASCADE
+);
+
 /*
 CREATE TABLE IF NOT EXISTS part(
     partid SERIAL PRIMARY KEY NOT NULL,
@@ -137,13 +226,45 @@ CREATE TABLE IF NOT EXISTS partfile(
     UNIQUE(partversionid, path)
 );
 */
+-- when a file was checked out, see locked/lockownerid
+ALTER TABLE file ADD COLUMN IF NOT EXISTS lockedat TIMESTAMP;
+-- locks are released by the lock sweeper after this, NULL means never
+ALTER TABLE file ADD COLUMN IF NOT EXISTS lockexpires TIMESTAMP;
+-- how many hours new locks in the team's projects last, 0 means forever
+ALTER TABLE team ADD COLUMN IF NOT EXISTS locktimeout INTEGER NOT NULL DEFAULT 0;
+-- for renames (changetype 4), the path the file was renamed from
+ALTER TABLE filerevision ADD COLUMN IF NOT EXISTS oldpath TEXT;
+-- which branch a commit is on (0 is main) and the commit before it on that branch,
+-- or the branch's base commit for its first commit
+ALTER TABLE commit ADD COLUMN IF NOT EXISTS branchid INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE commit ADD COLUMN IF NOT EXISTS parentid INTEGER;
+-- restricted projects are hidden from team members who aren't in a permission group mapped to them
+ALTER TABLE project ADD COLUMN IF NOT EXISTS restricted BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- per-project and per-file counters so numbering doesn't depend on COUNT(*),
+-- which hands out duplicates when two commits land at the same time
+ALTER TABLE project ADD COLUMN IF NOT EXISTS commitcounter INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE file ADD COLUMN IF NOT EXISTS revcounter INTEGER NOT NULL DEFAULT 0;
+
+-- the counter update takes a row lock on the project/file, so concurrent
+-- inserts wait for each other and always get the next number
 CREATE OR REPLACE FUNCTION update_commit_number()
 RETURNS TRIGGER
 LANGUAGE PLPGSQL
 AS
 $$
 BEGIN
-UPDATE commit SET cno = (SELECT COUNT(*) FROM commit WHERE projectid = NEW.projectid) WHERE commitid = NEW.commitid;
+UPDATE project SET commitcounter = commitcounter + 1 WHERE projectid = NEW.projectid
+RETURNING commitcounter INTO NEW.cno;
+
+-- we hold the project row now, so the branch head can't move under us.
+-- a promote moves the branch's base past its own commits, so it carries on from main after that
+IF NEW.parentid IS NULL THEN
+    NEW.parentid := GREATEST(
+        (SELECT MAX(commitid) FROM commit WHERE projectid = NEW.projectid AND branchid = NEW.branchid),
+        (SELECT basecommit FROM branch WHERE branchid = NEW.branchid)
+    );
+END IF;
 RETURN NEW;
 END;
 $$;
@@ -157,13 +278,142 @@ BEGIN
 INSERT INTO file(projectid, path) VALUES (NEW.projectid, NEW.path)
 ON CONFLICT(projectid, path) DO NOTHING;
 
-UPDATE filerevision SET frno = (SELECT COUNT(*) FROM filerevision WHERE path = NEW.path AND projectid = NEW.projectid) WHERE frid = NEW.frid;
-UPDATE filerevision set filesize = (SELECT COALESCE(SUM(blocksize), 0) FROM chunk WHERE chunk.filehash = NEW.filehash) WHERE frid = NEW.frid;
+-- a renamed file keeps counting from its old path's revisions
+IF NEW.changetype = 4 AND NEW.oldpath IS NOT NULL THEN
+    UPDATE file SET revcounter = GREATEST(revcounter, COALESCE((
+        SELECT old.revcounter FROM file old WHERE old.projectid = NEW.projectid AND old.path = NEW.oldpath
+    ), 0)) + 1 WHERE projectid = NEW.projectid AND path = NEW.path
+    RETURNING revcounter INTO NEW.frno;
+ELSE
+    UPDATE file SET revcounter = revcounter + 1 WHERE projectid = NEW.projectid AND path = NEW.path
+    RETURNING revcounter INTO NEW.frno;
+END IF;
+NEW.filesize := (SELECT COALESCE(SUM(blocksize), 0) FROM chunk WHERE chunk.filehash = NEW.filehash);
 
 RETURN NEW;
 END;
 $$;
 
+/*
+renumbers commits in insert order wherever numbers were duplicated or skipped,
+and file revisions of any path that has duplicate or missing numbers
+(other paths are left alone since renames carry numbering over from the old path),
+then syncs the counters to the highest number in use.
+returns how many rows were renumbered.
+changed rows are parked on negative numbers first so the unique indexes
+don't trip over rows that are swapping numbers.
+*/
+CREATE OR REPLACE FUNCTION repair_numbering()
+RETURNS INTEGER
+LANGUAGE PLPGSQL
+AS
+$$
+DECLARE
+commits INTEGER;
+revisions INTEGER;
+BEGIN
+UPDATE commit SET cno = -numbered.rn
+FROM (SELECT commitid, ROW_NUMBER() OVER (PARTITION BY projectid ORDER BY commitid) AS rn FROM commit) numbered
+WHERE commit.commitid = numbered.commitid AND commit.cno IS DISTINCT FROM numbered.rn;
+GET DIAGNOSTICS commits = ROW_COUNT;
+UPDATE commit SET cno = -cno WHERE cno < 0;
+
+UPDATE filerevision SET frno = -numbered.rn
+FROM (SELECT frid, ROW_NUMBER() OVER (PARTITION BY projectid, path ORDER BY frid) AS rn FROM filerevision
+    WHERE (projectid, path) IN (
+        SELECT projectid, path FROM filerevision GROUP BY projectid, path HAVING COUNT(*) <> COUNT(DISTINCT frno)
+    )) numbered
+WHERE filerevision.frid = numbered.frid AND filerevision.frno IS DISTINCT FROM numbered.rn;
+GET DIAGNOSTICS revisions = ROW_COUNT;
+UPDATE filerevision SET frno = -frno WHERE frno < 0;
+
+UPDATE project SET commitcounter = COALESCE((SELECT MAX(cno) FROM commit WHERE commit.projectid = project.projectid), 0);
+UPDATE file SET revcounter = COALESCE((SELECT MAX(frno) FROM filerevision
+    WHERE filerevision.projectid = file.projectid AND filerevision.path = file.path), 0);
+
+RETURN commits + revisions;
+END;
+$$;
+
+/*
+commits whose file revisions make up the project state at a commit: the commit and
+everything before it along parentid. a commit's parent never changes, so the state at
+a commit stays the same no matter what happens to its branch later
+*/
+CREATE OR REPLACE FUNCTION commit_ancestry(INTEGER, INTEGER)
+RETURNS TABLE(commitid INTEGER)
+LANGUAGE SQL
+STABLE
+AS
+$$
+WITH RECURSIVE ancestry(id, parent) AS (
+    SELECT commit.commitid, commit.parentid FROM commit
+    WHERE commit.projectid = $1 AND commit.commitid = $2
+    UNION ALL
+    SELECT commit.commitid, commit.parentid FROM commit
+    INNER JOIN ancestry ON commit.commitid = ancestry.parent
+)
+SELECT ancestry.id FROM ancestry;
+$$;
+
+CREATE OR REPLACE TRIGGER commitnumber BEFORE INSERT ON commit FOR EACH ROW EXECUTE FUNCTION update_commit_number();
+CREATE OR REPLACE TRIGGER filerevisionaudit BEFORE INSERT ON filerevision FOR EACH ROW EXECUTE FUNCTION audit_filerevision();
+
+-- databases from before the counters existed may have duplicate numbers,
+-- so repair them once before adding the unique indexes
+DO
+$$
+BEGIN
+IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'commit_projectid_cno_idx') THEN
+    PERFORM repair_numbering();
+    CREATE UNIQUE INDEX commit_projectid_cno_idx ON commit(projectid, cno);
+END IF;
+IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'filerevision_projectid_path_frno_idx') THEN
+    PERFORM repair_numbering();
+    CREATE UNIQUE INDEX filerevision_projectid_path_frno_idx ON filerevision(projectid, path, frno);
+END IF;
+END;
+$$;
+
+-- commits from before branches existed are all on main, point them at the commit before them
+UPDATE commit SET parentid = (
+    SELECT MAX(prev.commitid) FROM commit prev
+    WHERE prev.projectid = commit.projectid AND prev.branchid = 0 AND prev.commitid < commit.commitid
+)
+WHERE parentid IS NULL AND branchid = 0 AND EXISTS (
+    SELECT 1 FROM commit prev
+    WHERE prev.projectid = commit.projectid AND prev.branchid = 0 AND prev.commitid < commit.commitid
+);
+
+/*
+pgmapping.level is what a permission group gets on a project: 0 none, 1 read, 2 write, 3 manage.
+it used to be unused and always 0 while every mapping meant write access,
+so while the old default is still in place, move existing mappings to write
+*/
+DO
+$$
+BEGIN
+IF EXISTS (
+    SELECT 1 FROM information_schema.columns
+    WHERE table_name = 'pgmapping' AND column_name = 'level' AND column_default = '0'
+) THEN
+    UPDATE pgmapping SET level = 2 WHERE level = 0;
+    ALTER TABLE pgmapping ALTER COLUMN level SET DEFAULT 2;
+END IF;
+END;
+$$;
 
-CREATE OR REPLACE TRIGGER commitnumber AFTER INSERT ON commit FOR EACH ROW EXECUTE FUNCTION update_commit_number();
-CREATE OR REPLACE TRIGGER filerevisionaudit AFTER INSERT ON filerevision FOR EACH ROW EXECUTE FUNCTION audit_filerevision();
+-- blocks that teams' commits already use were uploaded before teamblock existed,
+-- so hand them to those teams once
+DO
+$$
+BEGIN
+IF NOT EXISTS (SELECT 1 FROM teamblock) THEN
+    INSERT INTO teamblock(teamid, blockhash)
+    SELECT DISTINCT project.teamid, chunk.blockhash FROM chunk
+    INNER JOIN filerevision ON filerevision.filehash = chunk.filehash
+    INNER JOIN project ON project.projectid = filerevision.projectid
+    ON CONFLICT(teamid, blockhash) DO NOTHING;
+END IF;
+END;
+$$;
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
+	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
+)
+
+// tag names need a letter so they never look like a commit number, e.g. "-5"
+var tagNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]*[A-Za-z][A-Za-z0-9._-]*$`)
+
+const maxTagNameLength = 100
+
+var errCommitNotFound = errors.New("commit not found")
+
+// resolves a commit number or tag name to a commit id and commit number
+func resolveCommitRef(ctx context.Context, projectId int, ref string) (int32, int, error) {
+	if cno, err := strconv.Atoi(ref); err == nil {
+		commitId, err := dal.Queries.GetCommitIdFromNo(ctx, sqlcgen.GetCommitIdFromNoParams{Projectid: int32(projectId), Cno: pgtype.Int4{Valid: true, Int32: int32(cno)}})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, 0, errCommitNotFound
+		}
+		return commitId, cno, err
+	}
+
+	tag, err := dal.Queries.GetTagCommit(ctx, sqlcgen.GetTagCommitParams{Projectid: int32(projectId), Name: ref})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, errCommitNotFound
+	}
+	return tag.Commitid, int(tag.Cno.Int32), err
+}
+
+func validTagName(name string) bool {
+	if len(name) > maxTagNameLength || !tagNamePattern.MatchString(name) {
+		return false
+	}
+	// resolveCommitRef would read it as a commit number
+	_, err := strconv.Atoi(name)
+	return err != nil
+}
+
+type Tag struct {
+	Name         string `json:"name"`
+	Message      string `json:"message"`
+	CreatorId    string `json:"creator_id"`
+	Creator      string `json:"creator"`
+	Timestamp    int64  `json:"timestamp"`
+	CommitId     int    `json:"commit_id"`
+	CommitNumber int    `json:"commit_number"`
+}
+
+type CreateTagRequest struct {
+	Name     string `json:"name"`
+	Message  string `json:"message"`
+	CommitId int    `json:"commit_id"`
+}
+
+type DeleteTagRequest struct {
+	Name string `json:"name"`
+}
+
+// input: url param project-id, body {name, message, commit_id}
+func CreateTag(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request CreateTagRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+	if !validTagName(request.Name) {
+		WriteCustomError(w, "invalid tag name")
+		return
+	}
+
+	if GetProjectPermissionByID(userId, projectId) < 3 {
+		log.Warn("insufficient permission", "user", userId, "projectId", projectId)
+		WriteCustomError(w, "no permission")
+		return
+	}
+
+	info, err := dal.Queries.GetCommitInfo(ctx, int32(request.CommitId))
+	if err != nil || int(info.Projectid) != projectId {
+		WriteCustomError(w, "invalid commit")
+		return
+	}
+
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	_, err = qtx.InsertTag(ctx, sqlcgen.InsertTagParams{
+		Projectid: int32(projectId),
+		Name:      request.Name,
+		Commitid:  int32(request.CommitId),
+		Message:   request.Message,
+		Userid:    userId,
+	})
+	if err != nil {
+		var e *pgconn.PgError
+		if errors.As(err, &e) && e.Code == pgerrcode.UniqueViolation {
+			WriteCustomError(w, "tag exists")
+			return
+		}
+		log.Error("couldn't create tag", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	err = writeAuditLog(ctx, qtx, projectId, userId, "tag-create", map[string]any{
+		"name":      request.Name,
+		"commit_id": request.CommitId,
+	})
+	if err != nil {
+		log.Error("couldn't write audit log", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	tx.Commit(ctx)
+	WriteDefaultSuccess(w, "tag created")
+}
+
+// input: url param project-id
+// returns the project's tags, newest first
+func GetProjectTags(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+
+	if GetProjectPermissionByID(claims.Subject, projectId) < 1 {
+		WriteCustomError(w, "no permission")
+		return
+	}
+
+	rows, err := dal.Queries.ListProjectTags(ctx, int32(projectId))
+	if err != nil {
+		log.Error("couldn't list tags", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+
+	var creatorIds []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		if !seen[row.Userid] {
+			seen[row.Userid] = true
+			creatorIds = append(creatorIds, row.Userid)
+		}
+	}
+	creators, err := GetUsersByIDs(creatorIds)
+	if err != nil {
+		log.Error("couldn't get tag creators", "err", err.Error())
+		WriteCustomError(w, "clerk error")
+		return
+	}
+
+	tags := make([]Tag, 0, len(rows))
+	for _, row := range rows {
+		tags = append(tags, Tag{
+			Name:         row.Name,
+			Message:      row.Message,
+			CreatorId:    row.Userid,
+			Creator:      creators[row.Userid].Name,
+			Timestamp:    row.Timestamp.Time.UnixNano() / 1000000000,
+			CommitId:     int(row.Commitid),
+			CommitNumber: int(row.Cno.Int32),
+		})
+	}
+	output_bytes, _ := json.Marshal(tags)
+	WriteSuccess(w, string(output_bytes))
+}
+
+// input: url param project-id, body {name}
+func DeleteTag(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	projectId, err := strconv.Atoi(chi.URLParam(r, "project-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request DeleteTagRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	if GetProjectPermissionByID(userId, projectId) < 3 {
+		log.Warn("insufficient permission", "user", userId, "projectId", projectId)
+		WriteCustomError(w, "no permission")
+		return
+	}
+
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		log.Error("couldn't create transaction", "error", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	commitId, err := qtx.DeleteTag(ctx, sqlcgen.DeleteTagParams{Projectid: int32(projectId), Name: request.Name})
+	if errors.Is(err, pgx.ErrNoRows) {
+		WriteCustomError(w, "tag not found")
+		return
+	} else if err != nil {
+		log.Error("couldn't delete tag", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	err = writeAuditLog(ctx, qtx, projectId, userId, "tag-delete", map[string]any{
+		"name":      request.Name,
+		"commit_id": commitId,
+	})
+	if err != nil {
+		log.Error("couldn't write audit log", "db err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	tx.Commit(ctx)
+
+	WriteDefaultSuccess(w, "tag deleted")
+}
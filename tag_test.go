@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidTagName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"v1", true},
+		{"v1.0.0", true},
+		{"release-2024_01", true},
+		{"1.0rc", true},
+		{"", false},
+		{"5", false},
+		{"-5", false},
+		{"+5", false},
+		{"1.0", false},
+		{"--", false},
+		{"._-", false},
+		{"has space", false},
+		{"a/b", false},
+		{strings.Repeat("a", maxTagNameLength), true},
+		{strings.Repeat("a", maxTagNameLength+1), false},
+	}
+	for _, test := range tests {
+		if got := validTagName(test.name); got != test.want {
+			t.Errorf("validTagName(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -11,9 +11,10 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/log"
-	"github.com/clerk/clerk-sdk-go/v2"
-	"github.com/clerk/clerk-sdk-go/v2/user"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
 	"github.com/joshtenorio/glassypdm-server/internal/dal"
 	"github.com/joshtenorio/glassypdm-server/internal/sqlcgen"
 )
@@ -56,7 +57,7 @@ type TeamCreationRequest struct {
 
 func CreateTeam(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -105,22 +106,16 @@ func CreateTeam(w http.ResponseWriter, r *http.Request) {
 // 3: owner
 func CheckPermissionByEmail(email string, teamid int) int {
 	ctx := context.Background()
-	searchResult := user.ListParams{EmailAddresses: []string{email}}
 
 	// we expect only one user per email
-	res, err := user.List(ctx, &searchResult)
-	if err != nil || len(res.Users) > 1 {
-		return -1
-	} else if len(res.Users) == 0 {
+	usr, err := auth.Users.FindUserByEmail(ctx, email)
+	if errors.Is(err, auth.ErrUserNotFound) {
 		return -2
+	} else if err != nil {
+		return -1
 	}
 
-	userid := ""
-	for _, user := range res.Users {
-		userid = user.ID
-	}
-
-	permission := CheckPermissionByID(teamid, userid)
+	permission := CheckPermissionByID(teamid, usr.ID)
 
 	return permission
 }
@@ -138,7 +133,7 @@ func CheckPermissionByID(teamid int, userid string) int {
 
 // input: email of person and what team
 func GetPermission(w http.ResponseWriter, r *http.Request) {
-	_, ok := clerk.SessionClaimsFromContext(r.Context())
+	_, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -175,7 +170,7 @@ type PermissionRequest struct {
 // inputs: email of person to set, and the desired permission level, and what team
 func SetPermission(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -214,23 +209,254 @@ func SetPermission(w http.ResponseWriter, r *http.Request) {
 	userID := GetUserIDByEmail(user)
 
 	// otherwise upsert teampermission
-	if proposedPermission != -4 {
+	switch proposedPermission {
+	case -4:
+		_, err = removeTeamMember(ctx, teamId, userID, setterId)
+	case TeamRoleOwner:
+		// the setter is the owner, they get demoted to manager
+		err = transferTeamOwnership(ctx, teamId, setterId, userID)
+	default:
 		_, err = dal.Queries.SetTeamPermission(ctx, sqlcgen.SetTeamPermissionParams{Userid: userID, Teamid: int32(teamId), Level: int32(proposedPermission)})
-		if proposedPermission == 3 {
-			// demote owner to manager if we are promoting a new owner
-			log.Info("demoting owner to manager since we are setting a new owner")
-			_, err = dal.Queries.SetTeamPermission(ctx, sqlcgen.SetTeamPermissionParams{Userid: setterId, Teamid: int32(teamId), Level: 2})
+	}
+	if errors.Is(err, errNotTeamMember) {
+		WriteCustomError(w, "user not in team")
+		return
+	} else if errors.Is(err, errNotTeamOwner) {
+		WriteError(w, insufficientPermission)
+		return
+	} else if err != nil {
+		log.Error("couldn't edit team permission", "userid", userID, "team", teamId, "level", proposedPermission, "error", err.Error())
+		WriteCustomError(w, "db error")
+		return
+	}
+	WriteDefaultSuccess(w, "valid")
+}
+
+var errNotTeamMember = errors.New("user is not in the team")
+var errNotTeamOwner = errors.New("user is not the team owner")
+
+type TeamMemberRequest struct {
+	UserId string `json:"user_id"`
+}
+
+type ReleasedLock struct {
+	ProjectId int    `json:"project_id"`
+	Path      string `json:"path"`
+}
+
+type RemoveMemberOutput struct {
+	UserId  string         `json:"user_id"`
+	Level   int            `json:"level"`   // the level they had in the team
+	PGroups []int          `json:"pgroups"` // permission groups they were taken out of
+	Locks   []ReleasedLock `json:"locks"`
+}
+
+// input: url param team-id, body {user_id}
+// managers can remove anyone below them, and anyone but the owner can leave.
+// the user is also taken out of the team's permission groups and their locks in the team's projects are released
+func RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
+	}
+	userId := claims.Subject
+	teamId, err := strconv.Atoi(chi.URLParam(r, "team-id"))
+	if err != nil {
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request TeamMemberRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.UserId == "" {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	removerPermission := CheckPermissionByID(teamId, userId)
+	memberPermission := CheckPermissionByID(teamId, request.UserId)
+	if memberPermission < TeamRoleMember {
+		WriteCustomError(w, "user not in team")
+		return
+	}
+	if memberPermission == TeamRoleOwner {
+		// the team always needs an owner, they have to transfer ownership first
+		WriteCustomError(w, "owner can't be removed")
+		return
+	}
+	if request.UserId != userId && !CanSetterUpdateUser(removerPermission, memberPermission, 0) {
+		WriteError(w, insufficientPermission)
+		return
+	}
+
+	output, err := removeTeamMember(ctx, teamId, request.UserId, userId)
+	if errors.Is(err, errNotTeamMember) {
+		WriteCustomError(w, "user not in team")
+		return
+	} else if err != nil {
+		log.Error("couldn't remove team member", "team", teamId, "user", request.UserId, "err", err)
+		WriteCustomError(w, "db error")
+		return
+	}
+	log.Info("removed team member", "team", teamId, "user", request.UserId, "by", userId)
+	output_bytes, _ := json.Marshal(output)
+	WriteSuccess(w, string(output_bytes))
+}
+
+// removes userId from the team, their permission groups in it, and releases their locks in its projects.
+// the owner can't be removed
+func removeTeamMember(ctx context.Context, teamId int, userId string, removerId string) (RemoveMemberOutput, error) {
+	output := RemoveMemberOutput{UserId: userId, PGroups: make([]int, 0), Locks: make([]ReleasedLock, 0)}
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		return output, err
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	removed, err := qtx.DeleteTeamPermission(ctx, sqlcgen.DeleteTeamPermissionParams{Userid: userId, Teamid: int32(teamId)})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return output, errNotTeamMember
+	} else if err != nil {
+		return output, err
+	}
+	if removed.Level == TeamRoleOwner {
+		return output, errNotTeamOwner
+	}
+	output.Level = int(removed.Level)
+
+	pgroups, err := qtx.RemoveMemberFromTeamPermissionGroups(ctx, sqlcgen.RemoveMemberFromTeamPermissionGroupsParams{Userid: userId, Teamid: int32(teamId)})
+	if err != nil {
+		return output, err
+	}
+	for _, pgroupId := range pgroups {
+		output.PGroups = append(output.PGroups, int(pgroupId))
+	}
+
+	locks, err := qtx.ReleaseUserTeamLocks(ctx, sqlcgen.ReleaseUserTeamLocksParams{
+		Lockownerid: pgtype.Text{String: userId, Valid: true},
+		Teamid:      int32(teamId),
+	})
+	if err != nil {
+		return output, err
+	}
+	released := make(map[int][]string)
+	for _, lock := range locks {
+		output.Locks = append(output.Locks, ReleasedLock{ProjectId: int(lock.Projectid), Path: lock.Path})
+		released[int(lock.Projectid)] = append(released[int(lock.Projectid)], lock.Path)
+	}
+
+	// the audit log is kept per project, so the removal goes in every project of the team
+	// along with the locks that were released in it
+	projects, err := qtx.FindTeamProjects(ctx, int32(teamId))
+	if err != nil {
+		return output, err
+	}
+	for _, project := range projects {
+		paths := released[int(project.Projectid)]
+		if paths == nil {
+			paths = make([]string, 0)
+		}
+		err = writeAuditLog(ctx, qtx, int(project.Projectid), removerId, "member-remove", map[string]any{
+			"user":    userId,
+			"level":   output.Level,
+			"pgroups": output.PGroups,
+			"paths":   paths,
+		})
+		if err != nil {
+			return output, err
 		}
+	}
+	return output, tx.Commit(ctx)
+}
 
-	} else {
-		_, err = dal.Queries.DeleteTeamPermission(ctx, userID)
+// input: url param team-id, body {user_id}
+// makes a team member the owner, the current owner becomes a manager
+func TransferTeamOwnership(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"access": "unauthorized"}`))
+		return
 	}
+	userId := claims.Subject
+	teamId, err := strconv.Atoi(chi.URLParam(r, "team-id"))
 	if err != nil {
-		log.Error("couldn't edit team permission", "userid", userID, "team", teamId, "level", proposedPermission, "error", err.Error())
+		WriteCustomError(w, "incorrect format")
+		return
+	}
+	var request TeamMemberRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.UserId == "" {
+		WriteCustomError(w, "bad json")
+		return
+	}
+
+	if CheckPermissionByID(teamId, userId) != TeamRoleOwner {
+		WriteError(w, insufficientPermission)
+		return
+	}
+	if request.UserId == userId {
+		WriteCustomError(w, "already owner")
+		return
+	}
+	if CheckPermissionByID(teamId, request.UserId) < TeamRoleMember {
+		WriteCustomError(w, "user not in team")
+		return
+	}
+
+	err = transferTeamOwnership(ctx, teamId, userId, request.UserId)
+	if errors.Is(err, errNotTeamOwner) {
+		WriteError(w, insufficientPermission)
+		return
+	} else if errors.Is(err, errNotTeamMember) {
+		WriteCustomError(w, "user not in team")
+		return
+	} else if err != nil {
+		log.Error("couldn't transfer team ownership", "team", teamId, "owner", userId, "new owner", request.UserId, "err", err)
 		WriteCustomError(w, "db error")
 		return
 	}
-	WriteDefaultSuccess(w, "valid")
+	log.Info("transferred team ownership", "team", teamId, "owner", userId, "new owner", request.UserId)
+	WriteDefaultSuccess(w, "ownership transferred")
+}
+
+// promotes newOwnerId to owner and demotes ownerId to manager in one transaction,
+// so the team never ends up with no owner or two
+func transferTeamOwnership(ctx context.Context, teamId int, ownerId string, newOwnerId string) error {
+	tx, err := dal.DbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	qtx := dal.Queries.WithTx(tx)
+
+	// lock the owner's row so two transfers can't both go through
+	level, err := qtx.GetTeamPermissionForUpdate(ctx, sqlcgen.GetTeamPermissionForUpdateParams{Teamid: int32(teamId), Userid: ownerId})
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && level != TeamRoleOwner) {
+		return errNotTeamOwner
+	} else if err != nil {
+		return err
+	}
+	// and the new owner's, so they can't be removed from the team while it happens
+	_, err = qtx.GetTeamPermissionForUpdate(ctx, sqlcgen.GetTeamPermissionForUpdateParams{Teamid: int32(teamId), Userid: newOwnerId})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errNotTeamMember
+	} else if err != nil {
+		return err
+	}
+	_, err = qtx.SetTeamPermission(ctx, sqlcgen.SetTeamPermissionParams{Userid: newOwnerId, Teamid: int32(teamId), Level: TeamRoleOwner})
+	if err != nil {
+		return err
+	}
+	_, err = qtx.SetTeamPermission(ctx, sqlcgen.SetTeamPermissionParams{Userid: ownerId, Teamid: int32(teamId), Level: TeamRoleManager})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 // s: setter permission level, u: user permission level, p: proposed permission level
@@ -250,7 +476,7 @@ func CanSetterUpdateUser(s int, u int, p int) bool {
 
 func GetTeamForUser(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -289,7 +515,7 @@ type GetTeamForUserResponse struct {
 
 func getTeamInformationByName(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -313,7 +539,7 @@ func getTeamInformationByName(w http.ResponseWriter, r *http.Request) {
 }
 
 func getTeamInformation(w http.ResponseWriter, r *http.Request) {
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
@@ -367,14 +593,15 @@ func QueryTeamInformation(w http.ResponseWriter, teamId int, userId string) {
 		return
 	}
 
-	// TODO smarter value?
-	clerklist, err := user.List(ctx, &user.ListParams{ListParams: clerk.ListParams{Limit: clerk.Int64(500)}})
+	var memberIds []string
+	for _, member := range memberdto {
+		memberIds = append(memberIds, member.Userid)
+	}
+	userlist, err := GetUsersByIDs(memberIds)
 	if err != nil {
 		WriteCustomError(w, "clerk error")
 		return
 	}
-	userlist := clerklist.Users
-	log.Info("total users in list:", "count", clerklist.TotalCount)
 
 	var members []Member
 	for _, member := range memberdto {
@@ -392,7 +619,7 @@ func QueryTeamInformation(w http.ResponseWriter, teamId int, userId string) {
 		}
 		m.Id = member.Userid
 
-		hehe, res := FindUserInList(member.Userid, userlist)
+		hehe, res := userlist[member.Userid]
 		if res {
 			m.Name = hehe.Name
 		} else {
@@ -431,7 +658,7 @@ type TeamInformation struct {
 
 func GetBasicTeamInfo(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
-	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	claims, ok := auth.SessionClaimsFromContext(r.Context())
 	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte(`{"access": "unauthorized"}`))
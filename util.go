@@ -8,10 +8,8 @@ import (
 	"os"
 
 	"github.com/charmbracelet/log"
-	"github.com/clerk/clerk-sdk-go/v2"
-	"github.com/clerk/clerk-sdk-go/v2/user"
 	_ "github.com/jackc/pgx/v5"
-	"github.com/joshtenorio/glassypdm-server/internal/dal"
+	"github.com/joshtenorio/glassypdm-server/internal/auth"
 )
 
 func IsServerOpen() bool {
@@ -34,8 +32,10 @@ func getConfig(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Key  string `json:"clerk_publickey"`
 		Name string `json:"name"`
+		Auth string `json:"auth"` // clerk or local
 	}{}
 	data.Key = os.Getenv("CLERK_PUBLICKEY")
+	data.Auth = auth.ProviderFromEnv()
 	data.Name = os.Getenv("SERVER_NAME")
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
@@ -43,50 +43,12 @@ func getConfig(w http.ResponseWriter, r *http.Request) {
 
 func GetUserIDByEmail(email string) string {
 	ctx := context.Background()
-	param := user.ListParams{EmailAddresses: []string{email}}
-
 	// we expect only one user per email
-	res, err := user.List(ctx, &param)
-	// FIXME handle error
-	if err != nil || len(res.Users) > 1 {
-		return ""
-	} else if len(res.Users) == 0 {
-		return ""
-	}
-
-	userid := ""
-	for _, user := range res.Users {
-		userid = user.ID
-	}
-	return userid
-}
-
-// checks if a user can generally upload files
-// doesn't check permission for specific projects/teams
-func canUserUpload(userId string) bool {
-	ctx := context.Background()
-
-	// check team permission
-	// TODO: ensure that a team has at least one project for this to be a valid check
-	teampermissions, err := dal.Queries.FindTeamPermissions(ctx, userId)
+	usr, err := auth.Users.FindUserByEmail(ctx, email)
 	if err != nil {
-		return false
-	}
-	for _, level := range teampermissions {
-		if level >= 2 {
-			return true
-		}
-	}
-
-	// check permission groups
-	groups, err := dal.Queries.FindUserInPermissionGroup(ctx, userId)
-	if err != nil {
-		return false
-	}
-	if len(groups) > 0 {
-		return true
+		return ""
 	}
-	return false
+	return usr.ID
 }
 
 type User struct {
@@ -98,30 +60,36 @@ type User struct {
 func GetUserByID(userId string) (User, bool) {
 	ctx := context.Background()
 	var output User
-	usr, err := user.Get(ctx, userId)
+	usr, err := auth.Users.GetUser(ctx, userId)
 	if err != nil {
 		log.Error("couldn't find user", "user", userId, "error", err.Error())
 		return output, false
 	}
 
 	output.UserId = userId
-	output.Name = *usr.FirstName + " " + *usr.LastName
-	output.EmailId = *usr.PrimaryEmailAddressID
+	output.Name = usr.Name
+	output.EmailId = usr.EmailID
 
 	return output, true
 }
 
-func FindUserInList(userId string, list []*clerk.User) (User, bool) {
-	var output User
-	for _, user := range list {
-		//log.Info("searching in list:", "supplied", userId, "current", user.ID)
-		if userId == user.ID {
-			output.UserId = userId
-			output.Name = *user.FirstName + " " + *user.LastName
-			output.EmailId = *user.PrimaryEmailAddressID
-			return output, true
+// looks up users in one request instead of one per user. ids that aren't found are left out
+func GetUsersByIDs(userIds []string) (map[string]User, error) {
+	ctx := context.Background()
+	users := make(map[string]User)
+	if len(userIds) == 0 {
+		return users, nil
+	}
+	res, err := auth.Users.GetUsers(ctx, userIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, usr := range res {
+		users[usr.ID] = User{
+			UserId:  usr.ID,
+			Name:    usr.Name,
+			EmailId: usr.EmailID,
 		}
 	}
-	log.Error("couldn't find user in list", "id", userId)
-	return output, false
+	return users, nil
 }